@@ -19,53 +19,106 @@ import (
 	"github.com/croessner/ldapbench/internal/fail"
 	"github.com/croessner/ldapbench/internal/ldapclient"
 	"github.com/croessner/ldapbench/internal/metrics"
+	"github.com/croessner/ldapbench/internal/prom"
 	"github.com/croessner/ldapbench/internal/report"
 	"github.com/croessner/ldapbench/internal/runner"
+	"github.com/croessner/ldapbench/internal/saturate"
 )
 
-func main() {
+// version is set at build time via -ldflags "-X main.version=...".
+var version = "dev"
+
+func main() { os.Exit(run()) }
+
+// run executes ldapbench and returns the exit code. Returning instead of
+// calling os.Exit lets the deferred closes flush the failure log and stats
+// file on every path.
+func run() int {
 	cfg, err := config.Parse()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
-		os.Exit(2)
+		return 2
+	}
+
+	if cfg.PrintConfig {
+		if err := cfg.WriteConfig(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+			return 2
+		}
+		return 0
 	}
 
 	// Check-only mode: run quick validations/tests and exit.
 	if cfg.CheckOnly {
 		if err := check.Run(cfg); err != nil {
-			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
-			os.Exit(2)
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", cfg.Redact(err.Error()))
+			return 2
 		}
 		fmt.Println("check: OK")
-		os.Exit(0)
+		return 0
 	}
 
 	users, err := csvdata.Load(cfg.CSVPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "csv error: %v\n", err)
-		os.Exit(2)
+		return 2
 	}
 
 	if len(users.All) == 0 {
 		fmt.Fprintf(os.Stderr, "csv error: no users found in %s\n", cfg.CSVPath)
-		os.Exit(2)
+		return 2
+	}
+
+	if cfg.UserSelect == config.UserSelectWeighted && !users.Weighted {
+		fmt.Fprintf(os.Stderr, "csv error: --user-select weighted requires a weight column in %s\n", cfg.CSVPath)
+		return 2
 	}
 
-	client, err := ldapclient.New(cfg)
+	// Users without a dn column need the lookup account to search their DN.
+	searchDNs := users.MissingDN()
+	if err := cfg.CheckLookup(searchDNs); err != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+		return 2
+	}
+
+	m := metrics.NewWithPrecision(cfg.LatencyPrecision)
+
+	client, err := ldapclient.New(cfg, m)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "ldap client error: %v\n", err)
-		os.Exit(2)
+		return 2
 	}
 
 	defer client.Close()
 
 	// Validate lookup bind works upfront so benchmark isn't skewed by initial failures.
-	if err := client.BindLookup(); err != nil {
-		fmt.Fprintf(os.Stderr, "lookup bind failed: %v\n", err)
-		os.Exit(2)
+	if cfg.NeedsLookup(searchDNs) {
+		if err := client.BindLookup(); err != nil {
+			fmt.Fprintf(os.Stderr, "lookup bind failed: %s\n", cfg.Redact(err.Error()))
+			return 2
+		}
+	}
+
+	// Fill the DN cache with the users whose DN is searched, so the measured
+	// phase starts with a warm cache.
+	if cfg.DNCachePrewarm && cfg.BindDNTemplate == "" {
+		var usernames []string
+		for _, u := range users.All {
+			if u.DN == "" {
+				usernames = append(usernames, u.Username)
+			}
+		}
+
+		start := time.Now()
+		n, err := client.PrewarmDNs(usernames)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dn cache prewarm failed: %s\n", cfg.Redact(err.Error()))
+			return 2
+		}
+
+		fmt.Printf("dn cache: prewarmed %d DNs in %v\n", n, time.Since(start).Truncate(time.Millisecond))
 	}
 
-	m := metrics.New()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -77,7 +130,36 @@ func main() {
 		cancel()
 	}()
 
+	// Optional Prometheus endpoint; it keeps serving until the summary is written.
+	if cfg.MetricsListen != "" {
+		ps, err := prom.Listen(cfg.MetricsListen, m)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "metrics error: %v\n", err)
+			return 2
+		}
+
+		defer ps.Close()
+		go func() {
+			if err := ps.Serve(); err != nil {
+				fmt.Fprintf(os.Stderr, "metrics error: %v\n", err)
+			}
+		}()
+	}
+
 	reporter := report.New(m, cfg.StatsInterval)
+
+	// Optional time series of the interval stats
+	if cfg.StatsFile != "" {
+		series, err := report.NewSeries(cfg.StatsFile, cfg.StatsFormat)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "stats file error: %v\n", err)
+			return 2
+		}
+
+		defer series.Close()
+		reporter.SetSeries(series)
+	}
+
 	go reporter.Run(ctx)
 
 	// Optional failure logger
@@ -89,20 +171,79 @@ func main() {
 
 	r := runner.New(cfg, client, users, m, flog)
 	start := time.Now()
-	err = r.Run(ctx)
+
+	// The saturation search runs one fixed-rate level after another instead
+	// of a single run.
+	var sat *saturate.Result
+	if cfg.FindMax != "" {
+		sat, err = saturate.Search(ctx, cfg, r.RunLevel)
+	} else {
+		err = r.Run(ctx)
+	}
+
+	// The warm-up phase is not part of the measured run.
+	if end := m.WarmupEnd(); !end.IsZero() {
+		start = end
+	}
+
 	elapsed := time.Since(start)
 
+	if errors.Is(err, runner.ErrUsersExhausted) {
+		fmt.Println("run ended early: every user was used once (--user-select sequential)")
+		err = nil
+	}
+
 	reporter.Stop()
 
-	report.PrintSummary(os.Stdout, m, elapsed)
+	// Remove entries created by add/delete workloads so test directories stay clean.
+	if n, cerr := r.Cleanup(); n > 0 || cerr != nil {
+		fmt.Printf("cleanup: removed %d created entries\n", n)
+		if cerr != nil {
+			fmt.Fprintf(os.Stderr, "cleanup error: %v\n", cerr)
+		}
+	}
+
+	if werr := writeSummary(cfg, m, report.Meta{Version: version, Start: start, Elapsed: elapsed, Settings: cfg.Settings(), Seed: cfg.Seed, Saturation: sat}); werr != nil {
+		fmt.Fprintf(os.Stderr, "output error: %v\n", werr)
+		return 1
+	}
+
 	if err != nil {
 		// Treat context cancellation (Ctrl+C) and deadline (normal duration end)
 		// as clean shutdowns without surfacing a run error.
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-			return
+			return 0
 		}
 
 		fmt.Fprintf(os.Stderr, "run error: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
+
+	return 0
+}
+
+// writeSummary writes the final summary in the configured format to the output
+// file, or to stdout when none is set. With an output file the text summary is
+// still printed to stdout.
+func writeSummary(cfg *config.Config, m *metrics.Metrics, meta report.Meta) error {
+	if cfg.OutputFile == "" {
+		return report.WriteResult(os.Stdout, cfg.OutputFormat, m, meta)
+	}
+
+	if err := report.WriteResult(os.Stdout, report.FormatText, m, meta); err != nil {
+		return err
+	}
+
+	f, err := os.Create(cfg.OutputFile)
+	if err != nil {
+		return fmt.Errorf("create output file: %w", err)
+	}
+
+	if err := report.WriteResult(f, cfg.OutputFormat, m, meta); err != nil {
+		_ = f.Close()
+
+		return fmt.Errorf("write output file: %w", err)
+	}
+
+	return f.Close()
 }
@@ -5,12 +5,16 @@ package check
 // without running the full benchmark.
 
 import (
+	"crypto/tls"
 	"fmt"
+	"math/rand/v2"
+	"slices"
 	"strings"
 
 	"github.com/croessner/ldapbench/internal/config"
 	"github.com/croessner/ldapbench/internal/csvdata"
 	"github.com/croessner/ldapbench/internal/ldapclient"
+	"github.com/croessner/ldapbench/internal/runner"
 )
 
 // newClient is a small indirection to allow tests to inject a fake LDAP client
@@ -29,42 +33,89 @@ func Run(cfg *config.Config) error {
 		return fmt.Errorf("csv error: no users found in %s", cfg.CSVPath)
 	}
 
+	// Negative rows are expected to fail, so the checks use the first user
+	// expected to succeed.
+	example := slices.IndexFunc(users.All, func(u csvdata.User) bool { return !u.ExpectFail })
+	if example < 0 {
+		return fmt.Errorf("csv error: no user in %s is expected to succeed (all rows have expected_ok=false)", cfg.CSVPath)
+	}
+
 	fmt.Printf("OK: CSV '%s' loaded (%d users)\n", cfg.CSVPath, len(users.All))
 
+	searchDNs := users.MissingDN()
+	if err := cfg.CheckLookup(searchDNs); err != nil {
+		return fmt.Errorf("config error: %w", err)
+	}
+
 	// LDAP client and lookup bind
-	client, err := newClient(cfg)
+	client, err := newClient(cfg, nil)
 	if err != nil {
 		return fmt.Errorf("ldap client error: %w", err)
 	}
 
 	defer client.Close()
 
-	if err := client.BindLookup(); err != nil {
-		return fmt.Errorf("lookup bind failed: %w", err)
+	if cfg.NeedsLookup(searchDNs) {
+		if err := client.BindLookup(); err != nil {
+			return fmt.Errorf("lookup bind failed: %w", err)
+		}
+
+		fmt.Println("OK: Lookup bind")
+	} else {
+		fmt.Println("OK: Lookup bind skipped (user DNs from --bind-dn-template or the dn column)")
 	}
 
-	fmt.Println("OK: Lookup bind")
+	if st, ok := client.TLSState(); ok {
+		fmt.Printf("OK: %s\n", describeTLS(st))
+	} else {
+		fmt.Println("OK: Connection without TLS")
+	}
 
-	// Check example user (first entry)
-	u := users.All[0]
+	// Check example user (first positive entry)
+	u := users.All[example]
+
+	ops := cfg.Ops()
+
+	// add and delete do not touch the user entry: create a probe entry below
+	// the container and remove it again.
+	if cfg.HasOp(config.OpAdd) || cfg.HasOp(config.OpDelete) {
+		if err := checkAddDelete(cfg, client, u); err != nil {
+			return err
+		}
+	}
+
+	if !slices.ContainsFunc(ops, config.Op.NeedsDN) {
+		return nil
+	}
 
-	dn, err := client.LookupDN(u.Username)
+	dn, err := runner.UserDN(cfg, client, u)
 	if err != nil {
 		return fmt.Errorf("lookup dn failed for user '%s': %w", u.Username, err)
 	}
 
-	fmt.Printf("OK: DN for user '%s' found: %s\n", u.Username, dn)
+	fmt.Printf("OK: DN for user '%s': %s\n", u.Username, dn)
 
-	// Depending on mode: test user bind and/or search
-	switch cfg.Mode {
-	case config.ModeAuth:
+	// Test every user operation of the mode (or mix) once.
+	for _, op := range ops {
+		if err := checkOp(cfg, client, u, dn, op); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkOp executes a single user operation against dn.
+func checkOp(cfg *config.Config, client ldapclient.Client, u csvdata.User, dn string, op config.Op) error {
+	switch op {
+	case config.OpBind:
 		if err := client.UserBind(dn, u.Password); err != nil {
 			return fmt.Errorf("user bind failed for '%s': %w", u.Username, err)
 		}
 
 		fmt.Printf("OK: User bind for '%s'\n", u.Username)
 
-	case config.ModeSearch:
+	case config.OpSearch:
 		filter := cfg.Filter
 		if strings.Contains(filter, "%s") {
 			filter = fmt.Sprintf(filter, u.Username)
@@ -76,24 +127,81 @@ func Run(cfg *config.Config) error {
 
 		fmt.Printf("OK: Search with filter '%s'\n", filter)
 
-	case config.ModeBoth:
-		if err := client.UserBind(dn, u.Password); err != nil {
-			return fmt.Errorf("user bind failed for '%s': %w", u.Username, err)
+	case config.OpCompare:
+		attr := u.Expand(cfg.CompareAttr)
+
+		ok, err := client.Compare(dn, u.Password, attr, u.Expand(cfg.CompareValue))
+		if err != nil {
+			return fmt.Errorf("compare failed for '%s' on attribute '%s': %w", u.Username, attr, err)
 		}
 
-		fmt.Printf("OK: User bind for '%s'\n", u.Username)
+		// compareFalse is a valid outcome; report it without failing the check.
+		fmt.Printf("OK: Compare of '%s' on %s returned %t\n", attr, dn, ok)
 
-		filter := cfg.Filter
-		if strings.Contains(filter, "%s") {
-			filter = fmt.Sprintf(filter, u.Username)
+	case config.OpModify:
+		attr := u.Expand(cfg.ModifyAttr)
+
+		var values []string
+		if v := u.Expand(strings.ReplaceAll(cfg.ModifyValue, "{id}", "check")); v != "" {
+			values = []string{v}
 		}
 
-		if _, err := client.UserSearch(dn, u.Password, filter); err != nil {
-			return fmt.Errorf("user search failed for '%s' with filter '%s': %w", u.Username, filter, err)
+		if err := client.Modify(dn, u.Password, cfg.ModifyOp, attr, values); err != nil {
+			return fmt.Errorf("modify (%s) of '%s' failed on %s: %w", cfg.ModifyOp, attr, dn, err)
 		}
 
-		fmt.Printf("OK: Search with filter '%s'\n", filter)
+		fmt.Printf("OK: Modify (%s) of '%s' on %s\n", cfg.ModifyOp, attr, dn)
+
+	case config.OpPasswd:
+		// Probe with a password like the run's, so a password policy judges
+		// both alike, and always restore the old one so the CSV stays valid.
+		newPassword := u.Columns["new_password"]
+		if newPassword == "" {
+			newPassword = runner.GeneratePassword(rand.New(rand.NewPCG(cfg.Seed, 0)), cfg.PasswdLength)
+		}
+
+		if err := client.PasswordModify(dn, u.Password, newPassword); err != nil {
+			return fmt.Errorf("password modify failed for '%s': %w", u.Username, err)
+		}
+
+		if err := client.PasswordModify(dn, newPassword, u.Password); err != nil {
+			return fmt.Errorf("password restore failed for '%s' (password is now the new value): %w", u.Username, err)
+		}
+
+		fmt.Printf("OK: Password modify and restore for '%s'\n", u.Username)
+	}
+
+	return nil
+}
+
+// checkAddDelete creates a single entry from the add templates and deletes it.
+func checkAddDelete(cfg *config.Config, client ldapclient.Client, u csvdata.User) error {
+	dn, attrs := runner.NewEntry(cfg, u, "check")
+	if err := client.Add(dn, attrs); err != nil {
+		return fmt.Errorf("add of %s failed: %w", dn, err)
 	}
 
+	fmt.Printf("OK: Add of %s\n", dn)
+
+	if err := client.Delete(dn); err != nil {
+		return fmt.Errorf("delete of %s failed (remove it manually): %w", dn, err)
+	}
+
+	fmt.Printf("OK: Delete of %s\n", dn)
+
 	return nil
 }
+
+// describeTLS summarizes the negotiated TLS parameters of a connection.
+func describeTLS(st tls.ConnectionState) string {
+	out := fmt.Sprintf("%s, cipher %s", tls.VersionName(st.Version), tls.CipherSuiteName(st.CipherSuite))
+	if st.CurveID != 0 {
+		out += fmt.Sprintf(", key exchange %s", st.CurveID)
+	}
+
+	if st.ServerName != "" {
+		out += fmt.Sprintf(", server name '%s'", st.ServerName)
+	}
+
+	return out
+}
@@ -1,22 +1,42 @@
 package check
 
 import (
+	"crypto/tls"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/croessner/ldapbench/internal/config"
 	"github.com/croessner/ldapbench/internal/ldapclient"
+	"github.com/croessner/ldapbench/internal/metrics"
 )
 
 // fake LDAP client implementing the interface used by check.Run
-type fakeClient struct{}
+type fakeClient struct {
+	bound     []string // DNs passed to UserBind
+	passwords []string // new passwords passed to PasswordModify
+}
 
-func (f *fakeClient) BindLookup() error                                   { return nil }
-func (f *fakeClient) LookupDN(username string) (string, error)            { return "dn-" + username, nil }
-func (f *fakeClient) UserBind(dn, password string) error                  { return nil }
-func (f *fakeClient) UserSearch(dn, password, filter string) (int, error) { return 1, nil }
-func (f *fakeClient) Close()                                              {}
+func (f *fakeClient) BindLookup() error                                           { return nil }
+func (f *fakeClient) LookupDN(username string) (string, error)                    { return "dn-" + username, nil }
+func (f *fakeClient) UserBind(dn, password string) error                          { f.bound = append(f.bound, dn); return nil }
+func (f *fakeClient) UserSearch(dn, password, filter string) (int, error)         { return 1, nil }
+func (f *fakeClient) Compare(dn, password, attribute, value string) (bool, error) { return true, nil }
+func (f *fakeClient) Modify(dn, password string, op config.ModifyOp, attr string, vals []string) error {
+	return nil
+}
+func (f *fakeClient) Add(dn string, attrs map[string][]string) error { return nil }
+func (f *fakeClient) Delete(dn string) error                         { return nil }
+func (f *fakeClient) PasswordModify(dn, oldPassword, newPassword string) error {
+	f.passwords = append(f.passwords, newPassword)
+
+	return nil
+}
+func (f *fakeClient) PrewarmDNs(usernames []string) (int, error) { return len(usernames), nil }
+func (f *fakeClient) TLSState() (tls.ConnectionState, bool)      { return tls.ConnectionState{}, false }
+func (f *fakeClient) Close()                                     {}
 
 func TestRun_CheckAllModes(t *testing.T) {
 	// prepare temp CSV
@@ -29,13 +49,15 @@ func TestRun_CheckAllModes(t *testing.T) {
 
 	// inject fake client factory
 	old := newClient
-	newClient = func(cfg *config.Config) (ldapclient.Client, error) { return &fakeClient{}, nil }
+	newClient = func(cfg *config.Config, m *metrics.Metrics) (ldapclient.Client, error) { return &fakeClient{}, nil }
 	t.Cleanup(func() { newClient = old })
 
 	// base cfg values used by check
-	base := &config.Config{CSVPath: csv, BaseDN: "dc=example,dc=org", UIDAttr: "uid", LookupBindDN: "cn=svc", LookupBindPass: "pw"}
+	base := &config.Config{CSVPath: csv, BaseDN: "dc=example,dc=org", UIDAttr: "uid", LookupBindDN: "cn=svc", LookupBindPass: "pw", CompareAttr: "userPassword", CompareValue: "{password}",
+		ModifyOp: config.ModifyReplace, ModifyAttr: "description", ModifyValue: "x", AddRDN: "cn=check-{id}", AddContainer: "dc=example,dc=org",
+		Mix: []config.WeightedOp{{Op: config.OpBind, Weight: 1}, {Op: config.OpAdd, Weight: 1}}}
 
-	for _, mode := range []config.Mode{config.ModeAuth, config.ModeSearch, config.ModeBoth} {
+	for _, mode := range []config.Mode{config.ModeAuth, config.ModeSearch, config.ModeBoth, config.ModeCompare, config.ModeModify, config.ModeAdd, config.ModeDelete, config.ModePasswd, config.ModeMix} {
 		c := *base
 		c.Mode = mode
 
@@ -44,3 +66,69 @@ func TestRun_CheckAllModes(t *testing.T) {
 		}
 	}
 }
+
+func TestRun_SkipsNegativeUsers(t *testing.T) {
+	fc := &fakeClient{}
+	old := newClient
+	newClient = func(cfg *config.Config, m *metrics.Metrics) (ldapclient.Client, error) { return fc, nil }
+	t.Cleanup(func() { newClient = old })
+
+	dir := t.TempDir()
+	run := func(content string) error {
+		csv := filepath.Join(dir, "users.csv")
+		if err := os.WriteFile(csv, []byte(content), 0o644); err != nil {
+			t.Fatalf("write csv: %v", err)
+		}
+
+		return Run(&config.Config{CSVPath: csv, Mode: config.ModeAuth, BaseDN: "dc=example,dc=org", UIDAttr: "uid", LookupBindDN: "cn=svc", LookupBindPass: "pw"})
+	}
+
+	if err := run("username,password,expected_ok\nlocked,wrong,false\nuser1,pass1,true\n"); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if !slices.Contains(fc.bound, "dn-user1") || slices.Contains(fc.bound, "dn-locked") {
+		t.Fatalf("expected the check to bind user1 only, bound %v", fc.bound)
+	}
+
+	err := run("username,password,expected_ok\nlocked,wrong,false\n")
+	if err == nil || !strings.Contains(err.Error(), "expected to succeed") {
+		t.Fatalf("expected error for CSV without positive users, got %v", err)
+	}
+}
+
+func TestRun_PasswdProbeLength(t *testing.T) {
+	fc := &fakeClient{}
+	old := newClient
+	newClient = func(cfg *config.Config, m *metrics.Metrics) (ldapclient.Client, error) { return fc, nil }
+	t.Cleanup(func() { newClient = old })
+
+	csv := filepath.Join(t.TempDir(), "users.csv")
+	if err := os.WriteFile(csv, []byte("username,password\nuser1,pass1\n"), 0o644); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+
+	cfg := &config.Config{CSVPath: csv, Mode: config.ModePasswd, BaseDN: "dc=example,dc=org", UIDAttr: "uid", LookupBindDN: "cn=svc", LookupBindPass: "pw", PasswdLength: 24, Seed: 1}
+	if err := Run(cfg); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// The probe password is generated like the run's; the second change
+	// restores the CSV password.
+	if len(fc.passwords) != 2 || len(fc.passwords[0]) != 24 || fc.passwords[1] != "pass1" {
+		t.Fatalf("unexpected password changes %q", fc.passwords)
+	}
+}
+
+func TestDescribeTLS(t *testing.T) {
+	st := tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256, CurveID: tls.X25519, ServerName: "ldap.example.com"}
+
+	want := "TLS 1.3, cipher TLS_AES_128_GCM_SHA256, key exchange X25519, server name 'ldap.example.com'"
+	if got := describeTLS(st); got != want {
+		t.Fatalf("describeTLS = %q, want %q", got, want)
+	}
+
+	if got := describeTLS(tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}); got != "TLS 1.2, cipher TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256" {
+		t.Fatalf("unexpected description: %q", got)
+	}
+}
@@ -5,7 +5,13 @@ package config
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
@@ -15,26 +21,180 @@ import (
 type Mode string
 
 const (
-	ModeAuth   Mode = "auth"
-	ModeSearch Mode = "search"
-	ModeBoth   Mode = "both"
+	ModeAuth    Mode = "auth"
+	ModeSearch  Mode = "search"
+	ModeBoth    Mode = "both"
+	ModeCompare Mode = "compare"
+	ModeModify  Mode = "modify"
+	ModeAdd     Mode = "add"
+	ModeDelete  Mode = "delete"
+	ModePasswd  Mode = "passwd"
+	ModeMix     Mode = "mix"
 )
 
+// Op names a single benchmark operation. Modes run a fixed sequence of
+// operations per iteration; mode=mix picks one operation per iteration by
+// weight.
+type Op string
+
+const (
+	OpBind    Op = "bind"
+	OpSearch  Op = "search"
+	OpCompare Op = "compare"
+	OpModify  Op = "modify"
+	OpAdd     Op = "add"
+	OpDelete  Op = "delete"
+	OpPasswd  Op = "passwd"
+)
+
+// NeedsDN reports whether op acts on the user's entry and therefore requires
+// the user DN to be resolved first. add and delete work on generated entries.
+func (o Op) NeedsDN() bool { return o != OpAdd && o != OpDelete }
+
+// UsesLookup reports whether op runs on a lookup connection as the lookup
+// account rather than on a user connection as the user.
+func (o Op) UsesLookup() bool { return o == OpAdd || o == OpDelete }
+
+// modeOps maps each fixed mode to the operations of one iteration.
+var modeOps = map[Mode][]Op{
+	ModeAuth:    {OpBind},
+	ModeSearch:  {OpSearch},
+	ModeBoth:    {OpBind, OpSearch},
+	ModeCompare: {OpCompare},
+	ModeModify:  {OpModify},
+	ModeAdd:     {OpAdd},
+	ModeDelete:  {OpDelete},
+	ModePasswd:  {OpPasswd},
+}
+
+// Ops returns the operations executed per iteration in mode m. It returns nil
+// for ModeMix, where the operation is chosen per iteration.
+func (m Mode) Ops() []Op { return modeOps[m] }
+
+// Arrival selects how iterations are started.
+type Arrival string
+
+const (
+	// ArrivalClosed runs each worker in a loop: the next iteration starts when
+	// the previous one returned (closed loop, optionally limited by --rate).
+	ArrivalClosed Arrival = "closed"
+	// ArrivalConstant schedules iterations at fixed intervals of 1/rate.
+	ArrivalConstant Arrival = "constant"
+	// ArrivalPoisson schedules iterations with exponentially distributed
+	// gaps averaging 1/rate.
+	ArrivalPoisson Arrival = "poisson"
+)
+
+// ConnPolicy selects the lifecycle of user connections.
+type ConnPolicy string
+
+const (
+	// ConnReuse keeps user connections in the pool and rebinds them for
+	// every operation, limited by ConnMaxAge and ConnMaxUses.
+	ConnReuse ConnPolicy = "reuse"
+	// ConnPerOperation opens a new connection for every operation (dial,
+	// TLS, bind, ...) and unbinds it afterwards, like PAM modules or web
+	// applications that connect per login.
+	ConnPerOperation ConnPolicy = "per-operation"
+)
+
+// UserSelect is the strategy picking the CSV user of each iteration.
+type UserSelect string
+
+const (
+	// UserSelectRandom picks users uniformly at random.
+	UserSelectRandom UserSelect = "random"
+	// UserSelectSequential uses every user exactly once in CSV order and
+	// ends the run when all users were used.
+	UserSelectSequential UserSelect = "sequential"
+	// UserSelectRoundRobin lets every worker cycle through all users, each
+	// starting at a different offset.
+	UserSelectRoundRobin UserSelect = "round-robin"
+	// UserSelectPartitioned gives every worker a disjoint slice of the users
+	// to cycle through.
+	UserSelectPartitioned UserSelect = "partitioned"
+	// UserSelectZipf skews the selection towards the first CSV rows following
+	// a Zipf distribution (hot set).
+	UserSelectZipf UserSelect = "zipf"
+	// UserSelectWeighted picks users proportionally to the CSV weight column.
+	UserSelectWeighted UserSelect = "weighted"
+)
+
+// WeightedOp is one entry of a weighted operation mix.
+type WeightedOp struct {
+	Op     Op
+	Weight int
+}
+
+// ModifyOp selects the change type used in modify mode.
+type ModifyOp string
+
+const (
+	ModifyReplace ModifyOp = "replace"
+	ModifyAdd     ModifyOp = "add"
+	ModifyDelete  ModifyOp = "delete"
+)
+
+// AttrTemplate is a single "type=value" attribute template used to build
+// entries in add mode. Value is expanded like the other templates.
+type AttrTemplate struct {
+	Type  string
+	Value string
+}
+
 // Config holds all runtime settings parsed from CLI flags.
 type Config struct {
-	LDAPURL            string
+	// LDAPURLs lists the servers; user connections are spread across them
+	// by ServerPolicy. A server whose connection fails is skipped for
+	// ServerRetry.
+	LDAPURLs     []string
+	ServerPolicy ServerPolicy
+	ServerRetry  time.Duration
+
 	StartTLS           bool
 	InsecureSkipVerify bool
 
 	LookupBindDN   string
-	LookupBindPass string
+	LookupBindPass string // from the flag, LookupBindPassFile or EnvLookupBindPass
 	BaseDN         string
 	UIDAttr        string
 
+	// LookupBindPassFile names a file holding the lookup password.
+	LookupBindPassFile string
+
+	// BindDNTemplate builds user DNs from the username ("%s", DN-escaped)
+	// instead of searching them with the lookup account.
+	BindDNTemplate string
+
 	CSVPath string
 	Mode    Mode
 	Filter  string
 
+	// Compare options (mode=compare). Both values are templates: "%s" is
+	// replaced with the username and "{column}" with the value of the named
+	// CSV column, e.g. --compare-value "{password}".
+	CompareAttr  string
+	CompareValue string
+
+	// Write options. Templates additionally understand "{id}", a value unique
+	// per generated entry or change within the run.
+	ModifyOp     ModifyOp // replace|add|delete
+	ModifyAttr   string
+	ModifyValue  string
+	AddContainer string // parent DN for entries created in add/delete mode; defaults to BaseDN
+	AddRDN       string // RDN template, e.g. cn=ldapbench-{id}
+	AddAttrs     []AttrTemplate
+
+	// Password Modify options (mode=passwd). The new password is taken from
+	// the CSV column new_password when present, otherwise it is generated with
+	// PasswdLength characters. With PasswdRotateBack the old password is
+	// restored right away so the CSV stays valid.
+	PasswdLength     int
+	PasswdRotateBack bool
+
+	// Mix is the weighted operation mix for mode=mix.
+	Mix []WeightedOp
+
 	// Auth options
 	// When true, user operations in search mode (and the search phase of mode=both)
 	// will authenticate via SASL/EXTERNAL instead of simple bind. This typically
@@ -48,6 +208,21 @@ type Config struct {
 	TLSCertPath string
 	TLSKeyPath  string
 
+	// Server verification and protocol settings. TLSCAFile adds trusted CAs
+	// (PEM bundle) instead of the system pool; TLSServerName overrides the
+	// host name verified against the server certificate. Zero or empty values
+	// keep the crypto/tls defaults.
+	TLSCAFile       string
+	TLSServerName   string
+	TLSMinVersion   uint16
+	TLSMaxVersion   uint16
+	TLSCipherSuites []uint16
+	TLSCurves       []tls.CurveID
+
+	// TLS material loaded and validated by Parse.
+	tlsCerts []tls.Certificate
+	tlsRoots *x509.CertPool
+
 	Concurrency   int
 	Connections   int
 	Duration      time.Duration
@@ -55,80 +230,506 @@ type Config struct {
 	StatsInterval time.Duration
 	Timeout       time.Duration // per-request timeout
 
+	// LookupConnections is the size of the pool of bound lookup
+	// connections. A broken one is re-dialed after ReconnectBackoff, which
+	// doubles with every failed attempt up to ReconnectMaxBackoff.
+	LookupConnections   int
+	ReconnectBackoff    time.Duration
+	ReconnectMaxBackoff time.Duration
+
+	// DNCacheTTL enables the cache of looked up DNs (0 = off), holding up to
+	// DNCacheSize entries; DNCachePrewarm fills it before the measured phase.
+	DNCacheTTL     time.Duration
+	DNCacheSize    int
+	DNCachePrewarm bool
+
+	// ConnPolicy is the lifecycle of user connections. With ConnReuse a
+	// connection is unbound and replaced once it is older than ConnMaxAge
+	// or served ConnMaxUses operations (0 = no limit).
+	ConnPolicy  ConnPolicy
+	ConnMaxAge  time.Duration
+	ConnMaxUses int
+
+	// UserSelect picks the user of every iteration; ZipfExponent (> 1) is
+	// the skew of UserSelectZipf.
+	UserSelect   UserSelect
+	ZipfExponent float64
+
+	// Seed drives all randomness of the run (user selection, operation mix,
+	// Poisson arrivals, generated values). Parse picks a random seed when
+	// none is given, so it is always set and can be reported.
+	Seed uint64
+
+	// RunID prefixes generated entry names and "{id}" values. Empty means a
+	// prefix built from the seed and the start time, unique per run.
+	RunID string
+
+	// Warmup is run before the measured part with the same load. Its
+	// measurements are kept separate and excluded from the summary.
+	Warmup time.Duration
+
+	// Open-loop arrivals. With Arrival constant or poisson, iterations are
+	// scheduled at intended times independent of completions and queued for
+	// the workers. Latency is measured from the intended start; schedules
+	// starting more than LateThreshold late are counted as late, and schedules
+	// that find MaxBacklog iterations already queued are dropped.
+	Arrival       Arrival
+	MaxBacklog    int
+	LateThreshold time.Duration
+
+	// Stages is the optional load profile. When set, the run executes the
+	// stages in order and Duration is their total; Rate and Concurrency only
+	// provide the defaults of the stages.
+	Stages []Stage
+
+	// Saturation search. With FindMax set, the run tests fixed rates between
+	// FindFrom and FindTo (0 = unbounded), each for Duration, until a level
+	// breaks the SLO, and reports the highest passing rate.
+	FindMax  Search
+	FindFrom float64
+	FindTo   float64
+	FindStep float64 // linear increment; resolution of the binary search
+	SLO      SLO
+
+	// LatencyPrecision is the number of significant decimal digits kept by
+	// the latency histograms (1..4).
+	LatencyPrecision int
+
 	// Optional failure logging
 	FailLogPath  string // path to write failed attempts (CSV). Empty disables.
 	FailLogBatch int    // how many records to buffer before writing
 
+	// Optional time series of every stats interval
+	StatsFile   string // path for interval samples; empty disables
+	StatsFormat string // jsonl|csv
+
+	// MetricsListen is the address of the Prometheus metrics endpoint
+	// (host:port); empty disables it.
+	MetricsListen string
+
+	// Final summary output
+	OutputFormat string // text|json|csv|markdown
+	OutputFile   string // path for the summary; empty writes to stdout
+
 	// CheckOnly, when true, runs a quick configuration/connectivity check and exits.
 	CheckOnly bool
+
+	// Configuration file (JSON, keyed by flag name) and the profile applied
+	// from it; flags on the command line override both.
+	ConfigFile string
+	Profile    string
+	// PrintConfig prints the effective configuration as a configuration file
+	// and exits.
+	PrintConfig bool
+
+	// flags is the parsed flag set, used to report the effective settings.
+	flags *pflag.FlagSet
 }
 
 // Parse reads CLI flags into a Config instance and validates essential fields.
 func Parse() (*Config, error) {
 	var cfg Config
-	pflag.StringVar(&cfg.LDAPURL, "ldap-url", "ldap://localhost:389", "LDAP URL, e.g. ldap://host:389, ldaps://host:636, or ldapi:// (Unix domain socket)")
+	var ldapURLs, ldapSRV, serverPolicy string
+	pflag.StringVar(&ldapURLs, "ldap-url", "ldap://localhost:389", "LDAP URL, e.g. ldap://host:389, ldaps://host:636, or ldapi:// (Unix domain socket); comma-separated for several servers")
+	pflag.StringVar(&ldapSRV, "ldap-srv", "", "Discover the servers from DNS SRV records: a domain (looked up as _ldap._tcp.<domain>) or a full record name such as _ldaps._tcp.example.com")
+	pflag.StringVar(&serverPolicy, "server-policy", string(ServerRoundRobin), "Server of each new user connection with several servers: round-robin|random|least-inflight")
+	pflag.DurationVar(&cfg.ServerRetry, "server-retry", 10*time.Second, "How long a server whose connection failed is skipped before it is tried again")
 	pflag.BoolVar(&cfg.StartTLS, "starttls", false, "Use STARTTLS on ldap:// connections")
 	pflag.BoolVar(&cfg.InsecureSkipVerify, "insecure-skip-verify", false, "Skip TLS certificate verification (unsafe, test only)")
 	pflag.StringVar(&cfg.TLSCertPath, "tls-cert", "", "Path to TLS client certificate (PEM) for mutual TLS")
 	pflag.StringVar(&cfg.TLSKeyPath, "tls-key", "", "Path to TLS client private key (PEM) for mutual TLS")
+	pflag.StringVar(&cfg.TLSCAFile, "tls-ca-file", "", "PEM bundle of CA certificates trusted for the server certificate (default: system pool)")
+	pflag.StringVar(&cfg.TLSServerName, "tls-server-name", "", "Server name for SNI and certificate verification (default: host of --ldap-url)")
+	var tlsMin, tlsMax, tlsCiphers, tlsCurves string
+	pflag.StringVar(&tlsMin, "tls-min-version", "", "Minimum TLS version: 1.0|1.1|1.2|1.3 (default: Go default, 1.2)")
+	pflag.StringVar(&tlsMax, "tls-max-version", "", "Maximum TLS version: 1.0|1.1|1.2|1.3 (default: 1.3)")
+	pflag.StringVar(&tlsCiphers, "tls-cipher-suites", "", "Comma-separated TLS 1.0-1.2 cipher suites, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (default: Go default)")
+	pflag.StringVar(&tlsCurves, "tls-curves", "", "Comma-separated key exchange curves in preference order: X25519MLKEM768|X25519|P256|P384|P521 (default: Go default)")
 	pflag.StringVar(&cfg.LookupBindDN, "lookup-bind-dn", "", "Lookup service account bind DN (optional when --sasl-external is set)")
-	pflag.StringVar(&cfg.LookupBindPass, "lookup-bind-pass", "", "Lookup service account password (optional when --sasl-external is set)")
+	pflag.StringVar(&cfg.LookupBindPass, "lookup-bind-pass", "", "Lookup service account password (optional when --sasl-external is set); prefer --lookup-bind-pass-file or $"+EnvLookupBindPass)
+	pflag.StringVar(&cfg.LookupBindPassFile, "lookup-bind-pass-file", "", "File containing the lookup service account password (trailing newline is ignored)")
 	pflag.StringVar(&cfg.BaseDN, "base-dn", "", "Base DN for user searches")
 	pflag.StringVar(&cfg.UIDAttr, "uid-attribute", "uid", "Attribute used to map username to DN (e.g., uid, sAMAccountName)")
+	pflag.StringVar(&cfg.BindDNTemplate, "bind-dn-template", "", "Build user DNs instead of searching them; %s is replaced with the DN-escaped username, e.g. uid=%s,ou=people,dc=example,dc=com")
 	pflag.StringVar(&cfg.CSVPath, "csv", "users.csv", "CSV file path with username,password header")
 	var mode string
-	pflag.StringVar(&mode, "mode", string(ModeAuth), "Benchmark mode: auth|search|both")
+	pflag.StringVar(&mode, "mode", string(ModeAuth), "Benchmark mode: auth|search|both|compare|modify|add|delete|passwd|mix")
+	var userSelect string
+	pflag.StringVar(&userSelect, "user-select", string(UserSelectRandom), "User selection: random|sequential|round-robin|partitioned|zipf|weighted")
+	pflag.Float64Var(&cfg.ZipfExponent, "zipf-exponent", 1.1, "Skew of --user-select zipf (> 1); higher values concentrate on fewer users")
 	pflag.StringVar(&cfg.Filter, "filter", "(objectClass=person)", "LDAP filter for search mode; use %s as username placeholder when desired")
+	pflag.StringVar(&cfg.CompareAttr, "compare-attribute", "userPassword", "Attribute used in compare mode")
+	pflag.StringVar(&cfg.CompareValue, "compare-value", "{password}", "Assertion value template for compare mode; %s is the username, {column} a CSV column")
+	var modifyOp string
+	pflag.StringVar(&modifyOp, "modify-op", string(ModifyReplace), "Change type for modify mode: replace|add|delete")
+	pflag.StringVar(&cfg.ModifyAttr, "modify-attribute", "description", "Attribute changed in modify mode")
+	pflag.StringVar(&cfg.ModifyValue, "modify-value", "ldapbench {id}", "Value template for modify mode; %s is the username, {column} a CSV column, {id} a unique id")
+	pflag.StringVar(&cfg.AddContainer, "add-container", "", "Parent DN for entries created in add/delete mode (default: base-dn)")
+	pflag.StringVar(&cfg.AddRDN, "add-rdn", "cn=ldapbench-{id}", "RDN template for entries created in add/delete mode")
+	var addAttrs []string
+	pflag.StringArrayVar(&addAttrs, "add-attr", []string{"objectClass=person", "sn={id}"}, "Attribute template type=value for created entries (repeatable)")
+	var mix string
+	pflag.StringVar(&mix, "mix", "bind=70,search=20,compare=8,modify=2", "Weighted operation mix for mode=mix, e.g. bind=70,search=20,compare=8,modify=2 (ops: bind|search|compare|modify|add|delete|passwd)")
+	pflag.IntVar(&cfg.PasswdLength, "passwd-length", 16, "Length of generated passwords in passwd mode")
+	pflag.BoolVar(&cfg.PasswdRotateBack, "passwd-rotate-back", true, "Restore the old password after each change in passwd mode")
 	pflag.BoolVar(&cfg.SaslExternal, "sasl-external", false, "Use SASL/EXTERNAL for search mode (and search phase of mode=both)")
 	pflag.IntVar(&cfg.Concurrency, "concurrency", 32, "Number of concurrent workers")
 	pflag.IntVar(&cfg.Connections, "connections", 1, "Connections per worker (>=1)")
+	pflag.IntVar(&cfg.LookupConnections, "lookup-connections", 4, "Bound lookup connections shared by all workers for DN lookups, add and delete (>=1)")
+	pflag.DurationVar(&cfg.ReconnectBackoff, "reconnect-backoff", 100*time.Millisecond, "Delay before a failed lookup connection is re-dialed again; doubles with every failed attempt")
+	pflag.DurationVar(&cfg.ReconnectMaxBackoff, "reconnect-max-backoff", 10*time.Second, "Upper limit of --reconnect-backoff")
+	var connPolicy string
+	pflag.StringVar(&connPolicy, "conn-policy", string(ConnReuse), "Lifecycle of user connections: reuse (pooled) | per-operation (dial, bind and unbind for every operation)")
+	pflag.DurationVar(&cfg.ConnMaxAge, "conn-max-age", 0, "conn-policy reuse: replace user connections older than this (0 = no limit)")
+	pflag.IntVar(&cfg.ConnMaxUses, "conn-max-uses", 0, "conn-policy reuse: replace user connections after this many operations (0 = no limit)")
+	pflag.DurationVar(&cfg.DNCacheTTL, "dn-cache-ttl", 0, "Cache looked up DNs for this long like an authentication front-end (0 = no cache)")
+	pflag.IntVar(&cfg.DNCacheSize, "dn-cache-size", 10000, "Maximum number of cached DNs; the least recently used one is evicted")
+	pflag.BoolVar(&cfg.DNCachePrewarm, "dn-cache-prewarm", false, "Look up the DNs of all CSV users into the cache before the measured phase")
 	pflag.DurationVar(&cfg.Duration, "duration", time.Minute, "Total benchmark duration")
 	pflag.Float64Var(&cfg.Rate, "rate", 0, "Target requests per second (0 = unlimited)")
+	pflag.Uint64Var(&cfg.Seed, "seed", 0, "Seed for all randomness; runs with the same seed issue the same request sequence per worker (0 = random)")
+	pflag.StringVar(&cfg.RunID, "run-id", "", "Prefix of generated entry names and {id} values (default: derived from the seed and the start time, unique per run)")
+	pflag.DurationVar(&cfg.Warmup, "warmup", 0, "Warm-up phase before the measured run; its metrics are excluded from the summary")
+	var stages, ramp, step string
+	pflag.StringVar(&stages, "stages", "", "Load profile: stages separated by ';' with duration=, rate= (n or from..to), concurrency=, name=")
+	pflag.StringVar(&ramp, "ramp", "", "Ramp the rate linearly over --duration, e.g. 100..1000")
+	pflag.StringVar(&step, "step", "", "Raise the rate by an increment every interval over --duration, starting at --rate, e.g. 100/30s")
+	var findMax, findRange string
+	pflag.StringVar(&findMax, "find-max", "", "Search the highest rate meeting the SLO: linear|binary (disabled when empty); every level runs for --duration")
+	pflag.StringVar(&findRange, "find-range", "", "Rates tested by --find-max as from or from..to (default: from --rate or --find-step, unbounded for linear)")
+	pflag.Float64Var(&cfg.FindStep, "find-step", 100, "Rate increment of the linear search and resolution of the binary search")
+	pflag.DurationVar(&cfg.SLO.P99, "slo-p99", 0, "SLO for --find-max: maximum p99 iteration latency (0 = not checked)")
+	pflag.Float64Var(&cfg.SLO.ErrorRate, "slo-error-rate", 0, "SLO for --find-max: maximum failed iterations in percent (0 = not checked)")
+	pflag.Float64Var(&cfg.SLO.Throughput, "slo-throughput", 90, "SLO for --find-max: minimum achieved share of the tested rate in percent (0 = not checked)")
+	var arrival string
+	pflag.StringVar(&arrival, "arrival", string(ArrivalClosed), "Arrival model: closed (workers loop) or open loop at --rate with constant|poisson arrivals")
+	pflag.IntVar(&cfg.MaxBacklog, "max-backlog", 10000, "Open loop: scheduled iterations queued for busy workers before new ones are dropped")
+	pflag.DurationVar(&cfg.LateThreshold, "late-threshold", time.Millisecond, "Open loop: delay after the intended start at which an iteration counts as late")
 	pflag.DurationVar(&cfg.StatsInterval, "stats-interval", time.Minute, "Statistics print interval")
 	pflag.DurationVar(&cfg.Timeout, "timeout", 5*time.Second, "Per-request timeout")
+	pflag.StringVar(&cfg.StatsFile, "stats-file", "", "Optional path to write every stats interval as a time series (disabled when empty)")
+	pflag.StringVar(&cfg.StatsFormat, "stats-format", "jsonl", "Time series format for --stats-file: jsonl|csv")
+	pflag.IntVar(&cfg.LatencyPrecision, "latency-precision", 3, "Significant decimal digits kept by latency histograms (1-4)")
 	pflag.StringVar(&cfg.FailLogPath, "fail-log", "", "Optional path to write failed attempts as CSV (disabled when empty)")
 	pflag.IntVar(&cfg.FailLogBatch, "fail-batch", 256, "Batch size for failure log writes")
+	pflag.StringVar(&cfg.MetricsListen, "metrics-listen", "", "Serve live metrics in Prometheus text format on this address, e.g. :9090 (disabled when empty)")
+	pflag.StringVar(&cfg.OutputFormat, "output-format", "text", "Final summary format: text|json|csv|markdown")
+	pflag.StringVar(&cfg.OutputFile, "output-file", "", "Write the final summary to this file instead of stdout")
 	pflag.BoolVar(&cfg.CheckOnly, "check", false, "Only check configuration/connectivity and exit")
+	pflag.StringVar(&cfg.ConfigFile, "config", "", "JSON configuration file with settings keyed by flag name and named profiles; command line flags override it")
+	pflag.StringVar(&cfg.Profile, "profile", "", "Profile from --config applied on top of its top-level settings")
+	pflag.BoolVar(&cfg.PrintConfig, "print-config", false, "Print the effective configuration as a --config file and exit")
 	pflag.Parse()
 
+	cfg.flags = pflag.CommandLine
+
+	if err := applyFile(pflag.CommandLine, cfg.ConfigFile, cfg.Profile); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.loadLookupPass(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.setTLS(tlsMin, tlsMax, tlsCiphers, tlsCurves); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.setServers(ldapURLs, ldapSRV, pflag.CommandLine.Changed("ldap-url")); err != nil {
+		return nil, err
+	}
+
+	switch ServerPolicy(serverPolicy) {
+	case ServerRoundRobin, ServerRandom, ServerLeastInFlight:
+		cfg.ServerPolicy = ServerPolicy(serverPolicy)
+	default:
+		return nil, errors.New("invalid server-policy: must be round-robin, random, or least-inflight")
+	}
+
 	switch Mode(mode) {
-	case ModeAuth, ModeSearch, ModeBoth:
+	case ModeAuth, ModeSearch, ModeBoth, ModeCompare, ModeModify, ModeAdd, ModeDelete, ModePasswd, ModeMix:
 		cfg.Mode = Mode(mode)
 	default:
-		return nil, errors.New("invalid mode: must be auth, search, or both")
+		return nil, errors.New("invalid mode: must be auth, search, both, compare, modify, add, delete, passwd, or mix")
+	}
+
+	if cfg.Mode == ModeMix {
+		m, err := ParseMix(mix)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Mix = m
+	}
+
+	if cfg.HasOp(OpPasswd) && cfg.PasswdLength <= 0 {
+		return nil, errors.New("passwd-length must be >= 1")
+	}
+
+	switch ModifyOp(modifyOp) {
+	case ModifyReplace, ModifyAdd, ModifyDelete:
+		cfg.ModifyOp = ModifyOp(modifyOp)
+	default:
+		return nil, errors.New("invalid modify-op: must be replace, add, or delete")
+	}
+
+	if cfg.HasOp(OpModify) && cfg.ModifyAttr == "" {
+		return nil, errors.New("modify-attribute is required in modify mode")
+	}
+
+	if !strings.Contains(cfg.AddRDN, "=") {
+		return nil, fmt.Errorf("invalid add-rdn %q: expected attr=value", cfg.AddRDN)
+	}
+
+	for _, a := range addAttrs {
+		typ, val, ok := strings.Cut(a, "=")
+		if !ok || typ == "" {
+			return nil, fmt.Errorf("invalid add-attr %q: expected type=value", a)
+		}
+
+		cfg.AddAttrs = append(cfg.AddAttrs, AttrTemplate{Type: typ, Value: val})
+	}
+
+	if cfg.HasOp(OpCompare) && cfg.CompareAttr == "" {
+		return nil, errors.New("compare-attribute is required in compare mode")
 	}
 
 	if cfg.BaseDN == "" {
 		return nil, errors.New("base-dn is required")
 	}
 
-	// Lookup credentials are required only when not using SASL/EXTERNAL for
-	// the lookup connection. With --sasl-external, lookup DN resolution runs
-	// under the external identity and DN/password may be omitted.
-	if !cfg.SaslExternal {
-		if cfg.LookupBindDN == "" || cfg.LookupBindPass == "" {
-			return nil, errors.New("lookup-bind-dn and lookup-bind-pass are required (or use --sasl-external)")
-		}
+	if cfg.AddContainer == "" {
+		cfg.AddContainer = cfg.BaseDN
+	}
+
+	if cfg.BindDNTemplate != "" && !strings.Contains(cfg.BindDNTemplate, "%s") {
+		return nil, errors.New("bind-dn-template must contain %s")
+	}
+
+	// Whether user DNs must be searched depends on the dn column of the CSV,
+	// so CheckLookup is repeated once the users are loaded.
+	if err := cfg.CheckLookup(false); err != nil {
+		return nil, err
 	}
 
 	if cfg.Concurrency <= 0 || cfg.Connections <= 0 {
 		return nil, errors.New("concurrency and connections must be >= 1")
 	}
 
+	if cfg.LookupConnections <= 0 {
+		return nil, errors.New("lookup-connections must be >= 1")
+	}
+
+	if cfg.ReconnectBackoff <= 0 || cfg.ReconnectMaxBackoff < cfg.ReconnectBackoff {
+		return nil, errors.New("reconnect-backoff must be > 0 and <= reconnect-max-backoff")
+	}
+
+	switch ConnPolicy(connPolicy) {
+	case ConnReuse, ConnPerOperation:
+		cfg.ConnPolicy = ConnPolicy(connPolicy)
+	default:
+		return nil, errors.New("invalid conn-policy: must be reuse or per-operation")
+	}
+
+	if cfg.ConnMaxAge < 0 || cfg.ConnMaxUses < 0 {
+		return nil, errors.New("conn-max-age and conn-max-uses must be >= 0")
+	}
+
+	if cfg.ConnPolicy == ConnPerOperation && (cfg.ConnMaxAge > 0 || cfg.ConnMaxUses > 0) {
+		return nil, errors.New("conn-max-age and conn-max-uses require conn-policy reuse")
+	}
+
+	if cfg.DNCacheTTL < 0 {
+		return nil, errors.New("dn-cache-ttl must be >= 0")
+	}
+
+	if cfg.DNCacheTTL > 0 && cfg.DNCacheSize <= 0 {
+		return nil, errors.New("dn-cache-size must be >= 1")
+	}
+
+	if cfg.DNCachePrewarm && cfg.DNCacheTTL == 0 {
+		return nil, errors.New("dn-cache-prewarm requires dn-cache-ttl")
+	}
+
+	switch UserSelect(userSelect) {
+	case UserSelectRandom, UserSelectSequential, UserSelectRoundRobin, UserSelectPartitioned, UserSelectZipf, UserSelectWeighted:
+		cfg.UserSelect = UserSelect(userSelect)
+	default:
+		return nil, errors.New("invalid user-select: must be random, sequential, round-robin, partitioned, zipf, or weighted")
+	}
+
+	if cfg.UserSelect == UserSelectZipf && cfg.ZipfExponent <= 1 {
+		return nil, errors.New("zipf-exponent must be > 1")
+	}
+
+	// Report the effective seed so every run can be repeated.
+	for cfg.Seed == 0 {
+		cfg.Seed = rand.Uint64()
+	}
+
+	_ = pflag.Set("seed", strconv.FormatUint(cfg.Seed, 10))
+
+	if cfg.Warmup < 0 {
+		return nil, errors.New("warmup must be >= 0")
+	}
+
+	if err := cfg.setStages(stages, ramp, step); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.setSearch(findMax, findRange); err != nil {
+		return nil, err
+	}
+
+	switch Arrival(arrival) {
+	case ArrivalClosed, ArrivalConstant, ArrivalPoisson:
+		cfg.Arrival = Arrival(arrival)
+	default:
+		return nil, errors.New("invalid arrival: must be closed, constant, or poisson")
+	}
+
+	if cfg.Arrival != ArrivalClosed {
+		if cfg.Rate <= 0 && len(cfg.Stages) == 0 && cfg.FindMax == "" {
+			return nil, errors.New("rate must be > 0 for open-loop arrivals")
+		}
+
+		for _, st := range cfg.Stages {
+			if st.Rate <= 0 || st.RateEnd <= 0 {
+				return nil, fmt.Errorf("stage %s: rate must be > 0 for open-loop arrivals", st.Name)
+			}
+		}
+
+		if cfg.MaxBacklog <= 0 {
+			return nil, errors.New("max-backlog must be >= 1")
+		}
+	}
+
+	if cfg.LatencyPrecision < 1 || cfg.LatencyPrecision > 4 {
+		return nil, errors.New("latency-precision must be between 1 and 4")
+	}
+
+	if cfg.StatsFormat != "jsonl" && cfg.StatsFormat != "csv" {
+		return nil, errors.New("invalid stats-format: must be jsonl or csv")
+	}
+
+	switch cfg.OutputFormat {
+	case "text", "json", "csv", "markdown":
+	default:
+		return nil, errors.New("invalid output-format: must be text, json, csv, or markdown")
+	}
+
 	return &cfg, nil
 }
 
-// TLSConfig returns a TLS config honoring the InsecureSkipVerify flag.
-func (c *Config) TLSConfig() *tls.Config {
-	// Build a TLS config honoring InsecureSkipVerify and optional client certs.
-	cfg := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
-	if c.TLSCertPath != "" && c.TLSKeyPath != "" {
-		if cert, err := tls.LoadX509KeyPair(c.TLSCertPath, c.TLSKeyPath); err == nil {
-			cfg.Certificates = []tls.Certificate{cert}
+// ParseMix parses a weighted operation mix such as "bind=70,search=30".
+// Weights are relative and need not add up to 100.
+func ParseMix(s string) ([]WeightedOp, error) {
+	var mix []WeightedOp
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, weight, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid mix entry %q: expected op=weight", part)
+		}
+
+		op := Op(strings.TrimSpace(name))
+		switch op {
+		case OpBind, OpSearch, OpCompare, OpModify, OpAdd, OpDelete, OpPasswd:
+		default:
+			return nil, fmt.Errorf("invalid mix entry %q: unknown operation %q", part, op)
+		}
+
+		w, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid mix entry %q: weight must be a non-negative integer", part)
+		}
+
+		if w > 0 {
+			mix = append(mix, WeightedOp{Op: op, Weight: w})
+		}
+	}
+
+	if len(mix) == 0 {
+		return nil, errors.New("mix must contain at least one operation with weight > 0")
+	}
+
+	return mix, nil
+}
+
+// Ops returns every operation the run may execute: the fixed sequence of the
+// mode or all operations of the mix.
+func (c *Config) Ops() []Op {
+	if c.Mode != ModeMix {
+		return c.Mode.Ops()
+	}
+
+	ops := make([]Op, 0, len(c.Mix))
+	for _, w := range c.Mix {
+		ops = append(ops, w.Op)
+	}
+
+	return ops
+}
+
+// HasOp reports whether the run may execute op.
+func (c *Config) HasOp(op Op) bool {
+	for _, o := range c.Ops() {
+		if o == op {
+			return true
 		}
-		// On error we intentionally ignore here; the dial will fail fast and
-		// surface a clear error to the user during connect/bind.
 	}
 
-	return cfg
+	return false
+}
+
+// NeedsLookup reports whether the run uses the lookup account: for
+// operations on the lookup connection or, when searchDNs is true (some users
+// have no DN in the CSV), to search user DNs without BindDNTemplate.
+func (c *Config) NeedsLookup(searchDNs bool) bool {
+	ops := c.Ops()
+	if slices.ContainsFunc(ops, Op.UsesLookup) {
+		return true
+	}
+
+	return searchDNs && c.BindDNTemplate == "" && slices.ContainsFunc(ops, Op.NeedsDN)
+}
+
+// CheckLookup returns an error when the run needs the lookup account (see
+// NeedsLookup) but has no credentials for it. With --sasl-external the lookup
+// connection authenticates as the external identity and needs none.
+func (c *Config) CheckLookup(searchDNs bool) error {
+	if c.SaslExternal || !c.NeedsLookup(searchDNs) || c.LookupBindDN != "" && c.LookupBindPass != "" {
+		return nil
+	}
+
+	if !slices.ContainsFunc(c.Ops(), Op.UsesLookup) {
+		return errors.New("lookup-bind-dn and lookup-bind-pass are required to search user DNs (or use --sasl-external, --bind-dn-template or a dn column in the CSV)")
+	}
+
+	return errors.New("lookup-bind-dn and lookup-bind-pass are required (or use --sasl-external)")
+}
+
+// Settings returns the effective value of every flag keyed by flag name.
+// Secret values are replaced with Redacted. It returns nil when the Config was
+// not created by Parse.
+func (c *Config) Settings() map[string]string {
+	if c.flags == nil {
+		return nil
+	}
+
+	out := make(map[string]string)
+	c.flags.VisitAll(func(f *pflag.Flag) {
+		v := f.Value.String()
+		if secretFlags[f.Name] && v != "" {
+			v = Redacted
+		}
+
+		out[f.Name] = c.Redact(v)
+	})
+
+	return out
 }
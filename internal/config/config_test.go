@@ -1,6 +1,12 @@
 package config
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
 
 func TestTLSConfigInsecure(t *testing.T) {
 	c := &Config{InsecureSkipVerify: true}
@@ -10,3 +16,199 @@ func TestTLSConfigInsecure(t *testing.T) {
 		t.Fatalf("expected InsecureSkipVerify=true")
 	}
 }
+
+func TestParseMix(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []WeightedOp
+		wantErr bool
+	}{
+		{in: "bind=70, search=30", want: []WeightedOp{{OpBind, 70}, {OpSearch, 30}}},
+		{in: "bind=1,compare=0", want: []WeightedOp{{OpBind, 1}}},
+		{in: "bind", wantErr: true},
+		{in: "bogus=1", wantErr: true},
+		{in: "bind=-1", wantErr: true},
+		{in: "bind=0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMix(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseMix(%q) err=%v, wantErr=%v", tt.in, err, tt.wantErr)
+		}
+
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("ParseMix(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestConfigOps(t *testing.T) {
+	c := &Config{Mode: ModeBoth}
+	if !reflect.DeepEqual(c.Ops(), []Op{OpBind, OpSearch}) {
+		t.Fatalf("unexpected ops for both: %v", c.Ops())
+	}
+
+	c = &Config{Mode: ModeMix, Mix: []WeightedOp{{OpCompare, 1}, {OpAdd, 1}}}
+	if !c.HasOp(OpAdd) || c.HasOp(OpBind) {
+		t.Fatalf("unexpected ops for mix: %v", c.Ops())
+	}
+}
+
+func TestCheckLookup(t *testing.T) {
+	creds := Config{LookupBindDN: "cn=svc", LookupBindPass: "pw"}
+	tests := []struct {
+		name      string
+		cfg       Config
+		searchDNs bool
+		wantErr   bool
+	}{
+		{name: "search without credentials", cfg: Config{Mode: ModeAuth}, searchDNs: true, wantErr: true},
+		{name: "search with credentials", cfg: creds, searchDNs: true},
+		{name: "sasl external", cfg: Config{Mode: ModeAuth, SaslExternal: true}, searchDNs: true},
+		{name: "template", cfg: Config{Mode: ModeBoth, BindDNTemplate: "uid=%s,dc=org"}, searchDNs: true},
+		{name: "dn column", cfg: Config{Mode: ModePasswd}},
+		{name: "compare and modify as the user", cfg: Config{Mode: ModeMix, Mix: []WeightedOp{{Op: OpCompare, Weight: 1}, {Op: OpModify, Weight: 1}}, BindDNTemplate: "uid=%s,dc=org"}, searchDNs: true},
+		{name: "lookup connection ops", cfg: Config{Mode: ModeAdd, BindDNTemplate: "uid=%s,dc=org"}, wantErr: true},
+		{name: "lookup connection ops in mix", cfg: Config{Mode: ModeMix, Mix: []WeightedOp{{Op: OpBind, Weight: 1}, {Op: OpAdd, Weight: 1}}}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.cfg.Mode == "" {
+				tc.cfg.Mode = ModeAuth
+			}
+
+			if err := tc.cfg.CheckLookup(tc.searchDNs); (err != nil) != tc.wantErr {
+				t.Fatalf("CheckLookup(%v) = %v, want error %v", tc.searchDNs, err, tc.wantErr)
+			}
+
+			if got := tc.cfg.NeedsLookup(tc.searchDNs); tc.wantErr && !got {
+				t.Fatal("expected the lookup account to be needed")
+			}
+		})
+	}
+}
+
+func TestSettingsRedactsSecrets(t *testing.T) {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.String("lookup-bind-pass", "", "")
+	fs.String("base-dn", "", "")
+	if err := fs.Parse([]string{"--lookup-bind-pass=secret", "--base-dn=dc=example,dc=org"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := (&Config{flags: fs}).Settings()
+	if got["lookup-bind-pass"] != Redacted || got["base-dn"] != "dc=example,dc=org" {
+		t.Fatalf("unexpected settings: %v", got)
+	}
+}
+
+func TestParseStages(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []Stage
+		wantErr bool
+	}{
+		{
+			in: "name=warm,duration=10s,rate=50; duration=1m,rate=100..200,concurrency=8",
+			want: []Stage{
+				{Name: "warm", Duration: 10 * time.Second, Rate: 50, RateEnd: 50, Concurrency: 4},
+				{Name: "stage2", Duration: time.Minute, Rate: 100, RateEnd: 200, Concurrency: 8},
+			},
+		},
+		{in: "duration=5s", want: []Stage{{Name: "stage1", Duration: 5 * time.Second, Rate: 10, RateEnd: 10, Concurrency: 4}}},
+		{in: "rate=10", wantErr: true},
+		{in: "duration=5s,bogus=1", wantErr: true},
+		{in: "duration=5s,rate=-1", wantErr: true},
+		{in: "duration=5s,concurrency=0", wantErr: true},
+		{in: "name=a,duration=1s;name=a,duration=1s", wantErr: true},
+		{in: " ; ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseStages(tt.in, 10, 4)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseStages(%q) err=%v, wantErr=%v", tt.in, err, tt.wantErr)
+		}
+
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("ParseStages(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStepAndRampStages(t *testing.T) {
+	steps, err := StepStages("100/30s", 0, 80*time.Second, 2)
+	if err != nil {
+		t.Fatalf("StepStages: %v", err)
+	}
+
+	want := []Stage{
+		{Name: "step1", Duration: 30 * time.Second, Rate: 100, RateEnd: 100, Concurrency: 2},
+		{Name: "step2", Duration: 30 * time.Second, Rate: 200, RateEnd: 200, Concurrency: 2},
+		{Name: "step3", Duration: 20 * time.Second, Rate: 300, RateEnd: 300, Concurrency: 2},
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Fatalf("StepStages = %+v, want %+v", steps, want)
+	}
+
+	ramp, err := RampStages("100..1000", time.Minute, 2)
+	if err != nil {
+		t.Fatalf("RampStages: %v", err)
+	}
+
+	if got := ramp[0].RateAt(30 * time.Second); got != 550 {
+		t.Fatalf("RateAt(30s) = %v, want 550", got)
+	}
+
+	if _, err := RampStages("0..100", time.Minute, 2); err == nil {
+		t.Fatalf("expected error for ramp starting at 0")
+	}
+
+	c := &Config{Duration: time.Minute, Concurrency: 1}
+	if err := c.setStages("duration=1s", "1..2", ""); err == nil {
+		t.Fatalf("expected error for stages and ramp together")
+	}
+
+	if err := c.setStages("duration=1s;duration=2s,concurrency=3", "", ""); err != nil || c.Duration != 3*time.Second || c.MaxConcurrency() != 3 {
+		t.Fatalf("setStages: err=%v duration=%v max=%d", err, c.Duration, c.MaxConcurrency())
+	}
+}
+
+func TestSetSearch(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		search   string
+		rng      string
+		wantErr  bool
+		from, to float64
+	}{
+		{name: "disabled", cfg: Config{}, search: ""},
+		{name: "linear defaults", cfg: Config{FindStep: 50, SLO: SLO{P99: time.Millisecond}}, search: "linear", from: 50},
+		{name: "linear from rate", cfg: Config{Rate: 200, FindStep: 50, SLO: SLO{ErrorRate: 1}}, search: "linear", from: 200},
+		{name: "binary range", cfg: Config{FindStep: 50, SLO: SLO{P99: time.Millisecond}}, search: "binary", rng: "100..1000", from: 100, to: 1000},
+		{name: "linear single rate", cfg: Config{FindStep: 50, SLO: SLO{P99: time.Millisecond}}, search: "linear", rng: "200", from: 200},
+		{name: "binary single rate", cfg: Config{FindStep: 50, SLO: SLO{P99: time.Millisecond}}, search: "binary", rng: "200", wantErr: true},
+		{name: "binary without range", cfg: Config{FindStep: 50, SLO: SLO{P99: time.Millisecond}}, search: "binary", wantErr: true},
+		{name: "no slo", cfg: Config{FindStep: 50}, search: "linear", wantErr: true},
+		{name: "bad search", cfg: Config{FindStep: 50, SLO: SLO{P99: time.Millisecond}}, search: "random", wantErr: true},
+		{name: "with stages", cfg: Config{FindStep: 50, SLO: SLO{P99: time.Millisecond}, Stages: []Stage{{}}}, search: "linear", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := tt.cfg.setSearch(tt.search, tt.rng)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: err=%v, wantErr=%v", tt.name, err, tt.wantErr)
+		}
+
+		if !tt.wantErr && (tt.cfg.FindFrom != tt.from || tt.cfg.FindTo != tt.to) {
+			t.Fatalf("%s: range %v..%v, want %v..%v", tt.name, tt.cfg.FindFrom, tt.cfg.FindTo, tt.from, tt.to)
+		}
+	}
+
+	if got := (SLO{P99: 50 * time.Millisecond, ErrorRate: 1, Throughput: 90}).String(); got != "p99<=50ms error_rate<=1% throughput>=90%" {
+		t.Fatalf("SLO.String() = %q", got)
+	}
+}
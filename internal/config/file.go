@@ -0,0 +1,228 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// fileFlags are the flags that select or print the configuration file; they
+// are not settings of their own and cannot appear in the file.
+var fileFlags = map[string]bool{
+	"config":       true,
+	"profile":      true,
+	"print-config": true,
+}
+
+// fileConfig is the JSON configuration file. Settings are keyed by flag name
+// (e.g. "ldap-url", "duration"); profiles are named sets of settings that are
+// applied on top of them with --profile.
+type fileConfig struct {
+	Settings map[string]json.RawMessage
+	Profiles map[string]map[string]json.RawMessage
+}
+
+// readFile parses the configuration file at path.
+func readFile(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+
+	fc := &fileConfig{Settings: raw}
+	if p, ok := raw["profiles"]; ok {
+		if err := json.Unmarshal(p, &fc.Profiles); err != nil {
+			return nil, fmt.Errorf("config %s: profiles: %w", path, err)
+		}
+
+		delete(raw, "profiles")
+	}
+
+	return fc, nil
+}
+
+// applyFile sets the flags of fs from the configuration file at path and the
+// named profile in it. Profile settings override the file's top-level
+// settings; flags given on the command line override both and are left
+// untouched. Call it after fs.Parse.
+func applyFile(fs *pflag.FlagSet, path, profile string) error {
+	if path == "" {
+		if profile != "" {
+			return errors.New("profile requires --config")
+		}
+
+		return nil
+	}
+
+	fc, err := readFile(path)
+	if err != nil {
+		return err
+	}
+
+	settings := fc.Settings
+	if profile != "" {
+		p, ok := fc.Profiles[profile]
+		if !ok {
+			names := make([]string, 0, len(fc.Profiles))
+			for name := range fc.Profiles {
+				names = append(names, name)
+			}
+
+			sort.Strings(names)
+
+			return fmt.Errorf("config %s: unknown profile %q (available: %s)", path, profile, strings.Join(names, ", "))
+		}
+
+		merged := make(map[string]json.RawMessage, len(settings)+len(p))
+		for name, v := range settings {
+			merged[name] = v
+		}
+
+		for name, v := range p {
+			merged[name] = v
+		}
+
+		settings = merged
+	}
+
+	// Remember the command line before setting anything, as Set marks a
+	// flag as changed.
+	cli := make(map[string]bool)
+	fs.Visit(func(f *pflag.Flag) { cli[f.Name] = true })
+
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if fileFlags[name] || fs.Lookup(name) == nil {
+			return fmt.Errorf("config %s: unknown setting %q", path, name)
+		}
+
+		if cli[name] {
+			continue
+		}
+
+		values, err := fileValues(settings[name])
+		if err != nil {
+			return fmt.Errorf("config %s: %s: %w", path, name, err)
+		}
+
+		// A secret printed by --print-config is a placeholder, not a value.
+		if secretFlags[name] && len(values) == 1 && values[0] == Redacted {
+			continue
+		}
+
+		for _, v := range values {
+			if err := fs.Set(name, v); err != nil {
+				return fmt.Errorf("config %s: %s: %w", path, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// fileValues converts a JSON value to the flag values it sets: one value for
+// a string, number or boolean and one per element for an array (repeatable
+// flags such as add-attr).
+func fileValues(raw json.RawMessage) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	if list, ok := v.([]any); ok {
+		out := make([]string, 0, len(list))
+		for _, e := range list {
+			s, err := fileValue(e)
+			if err != nil {
+				return nil, err
+			}
+
+			out = append(out, s)
+		}
+
+		return out, nil
+	}
+
+	s, err := fileValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{s}, nil
+}
+
+func fileValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v: expected a string, number, boolean, or array of them", v)
+	}
+}
+
+// WriteConfig writes the effective configuration as a JSON configuration
+// file that --config accepts. Secret values are replaced with Redacted. It
+// writes nothing when the Config was not created by Parse.
+func (c *Config) WriteConfig(w io.Writer) error {
+	if c.flags == nil {
+		return nil
+	}
+
+	out := make(map[string]any)
+	c.flags.VisitAll(func(f *pflag.Flag) {
+		if fileFlags[f.Name] {
+			return
+		}
+
+		v := f.Value.String()
+		switch {
+		case secretFlags[f.Name] && v != "":
+			out[f.Name] = Redacted
+		case f.Value.Type() == "bool":
+			out[f.Name] = v == "true"
+		case f.Value.Type() == "stringArray":
+			values, _ := c.flags.GetStringArray(f.Name)
+			for i := range values {
+				values[i] = c.Redact(values[i])
+			}
+
+			out[f.Name] = values
+		case strings.HasPrefix(f.Value.Type(), "int") || strings.HasPrefix(f.Value.Type(), "uint") || strings.HasPrefix(f.Value.Type(), "float"):
+			out[f.Name] = json.Number(v)
+		default:
+			out[f.Name] = c.Redact(v)
+		}
+	})
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false) // keep filters such as (&(uid=%s)) readable
+
+	return enc.Encode(out)
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func testFlags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.String("ldap-url", "ldap://localhost:389", "")
+	fs.String("lookup-bind-pass", "", "")
+	fs.Duration("duration", time.Minute, "")
+	fs.Float64("rate", 0, "")
+	fs.Int("concurrency", 32, "")
+	fs.Uint64("seed", 0, "")
+	fs.Bool("starttls", false, "")
+	fs.StringArray("add-attr", []string{"objectClass=person"}, "")
+
+	return fs
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	p := filepath.Join(t.TempDir(), "ldapbench.json")
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestApplyFile(t *testing.T) {
+	path := writeConfig(t, `{
+  "ldap-url": "ldaps://ldap.example.com",
+  "duration": "10m",
+  "concurrency": 64,
+  "starttls": true,
+  "add-attr": ["objectClass=inetOrgPerson", "sn={id}"],
+  "profiles": {
+    "soak": {"duration": "8h", "rate": 200},
+    "peak": {"rate": 5000, "concurrency": 512}
+  }
+}`)
+
+	tests := []struct {
+		name    string
+		profile string
+		args    []string
+		want    map[string]string
+	}{
+		{
+			name: "file",
+			want: map[string]string{"ldap-url": "ldaps://ldap.example.com", "duration": "10m0s", "rate": "0", "concurrency": "64", "starttls": "true", "add-attr": "[objectClass=inetOrgPerson,sn={id}]"},
+		},
+		{
+			name:    "profile",
+			profile: "soak",
+			want:    map[string]string{"duration": "8h0m0s", "rate": "200", "concurrency": "64"},
+		},
+		{
+			name:    "command line wins",
+			profile: "peak",
+			args:    []string{"--rate=100", "--add-attr=sn=x"},
+			want:    map[string]string{"rate": "100", "concurrency": "512", "add-attr": "[sn=x]"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := testFlags()
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := applyFile(fs, path, tc.profile); err != nil {
+				t.Fatalf("applyFile: %v", err)
+			}
+
+			for name, want := range tc.want {
+				if got := fs.Lookup(name).Value.String(); got != want {
+					t.Fatalf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyFile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		profile string
+		want    string
+	}{
+		{name: "unknown setting", content: `{"no-such-flag": 1}`, want: `unknown setting "no-such-flag"`},
+		{name: "nested config", content: `{"config": "other.json"}`, want: `unknown setting "config"`},
+		{name: "unknown profile", content: `{"profiles": {"soak": {}, "peak": {}}}`, profile: "smoke", want: `unknown profile "smoke" (available: peak, soak)`},
+		{name: "invalid value", content: `{"duration": "soon"}`, want: "duration"},
+		{name: "object value", content: `{"rate": {"from": 1}}`, want: "unsupported value"},
+		{name: "syntax", content: `{"rate": }`, want: "invalid character"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := applyFile(testFlags(), writeConfig(t, tc.content), tc.profile)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+
+	redacted := testFlags()
+	if err := applyFile(redacted, writeConfig(t, `{"lookup-bind-pass": "REDACTED"}`), ""); err != nil || redacted.Changed("lookup-bind-pass") {
+		t.Fatalf("expected the REDACTED placeholder to be skipped: %v", err)
+	}
+
+	if err := applyFile(testFlags(), "", "soak"); err == nil {
+		t.Fatal("expected error for --profile without --config")
+	}
+}
+
+func TestWriteConfig_RoundTrip(t *testing.T) {
+	fs := testFlags()
+	if err := fs.Parse([]string{"--ldap-url=ldapi://", "--rate=12.5", "--seed=18446744073709551615", "--starttls", "--add-attr=sn=a", "--add-attr=cn=(&b)"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := (&Config{flags: fs}).WriteConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), `"rate": 12.5`) || !strings.Contains(buf.String(), `"cn=(&b)"`) {
+		t.Fatalf("unexpected config: %s", buf.String())
+	}
+
+	again := testFlags()
+	if err := applyFile(again, writeConfig(t, buf.String()), ""); err != nil {
+		t.Fatalf("printed config does not load: %v", err)
+	}
+
+	got, want := (&Config{flags: again}).Settings(), (&Config{flags: fs}).Settings()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("round trip mismatch:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestWriteConfig_RedactsSecrets(t *testing.T) {
+	fs := testFlags()
+	if err := fs.Parse([]string{"--lookup-bind-pass=secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := (&Config{flags: fs}).WriteConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(buf.String(), "secret") || !strings.Contains(buf.String(), `"lookup-bind-pass": "REDACTED"`) {
+		t.Fatalf("secret not redacted: %s", buf.String())
+	}
+}
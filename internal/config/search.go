@@ -0,0 +1,108 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Search selects how the saturation search picks the rates it tests.
+type Search string
+
+const (
+	// SearchLinear raises the rate by a fixed step until a level breaks the
+	// SLO.
+	SearchLinear Search = "linear"
+	// SearchBinary bisects a rate range down to the step size.
+	SearchBinary Search = "binary"
+)
+
+// SLO is the objective every level of a saturation search must meet. Zero
+// values disable a criterion.
+type SLO struct {
+	P99        time.Duration // maximum p99 iteration latency
+	ErrorRate  float64       // maximum failed iterations in percent
+	Throughput float64       // minimum achieved share of the target rate in percent
+}
+
+// String returns the SLO in a compact form such as "p99<=50ms error_rate<=1%".
+func (s SLO) String() string {
+	var out string
+	if s.P99 > 0 {
+		out += fmt.Sprintf(" p99<=%v", s.P99)
+	}
+
+	if s.ErrorRate > 0 {
+		out += fmt.Sprintf(" error_rate<=%g%%", s.ErrorRate)
+	}
+
+	if s.Throughput > 0 {
+		out += fmt.Sprintf(" throughput>=%g%%", s.Throughput)
+	}
+
+	if out == "" {
+		return "none"
+	}
+
+	return out[1:]
+}
+
+// setSearch validates the saturation search settings. rangeSpec is "from" or
+// "from..to"; from defaults to Rate or the step, to = 0 means no upper bound
+// (linear only).
+func (c *Config) setSearch(search, rangeSpec string) error {
+	if search == "" {
+		return nil
+	}
+
+	switch Search(search) {
+	case SearchLinear, SearchBinary:
+		c.FindMax = Search(search)
+	default:
+		return errors.New("invalid find-max: must be linear or binary")
+	}
+
+	if len(c.Stages) > 0 {
+		return errors.New("find-max cannot be combined with stages, ramp, or step")
+	}
+
+	if c.FindStep <= 0 {
+		return errors.New("find-step must be > 0")
+	}
+
+	if c.SLO.P99 <= 0 && c.SLO.ErrorRate <= 0 {
+		return errors.New("find-max requires slo-p99 or slo-error-rate")
+	}
+
+	if c.SLO.ErrorRate < 0 || c.SLO.Throughput < 0 || c.SLO.Throughput > 100 {
+		return errors.New("slo-error-rate must be >= 0 and slo-throughput between 0 and 100")
+	}
+
+	c.FindFrom, c.FindTo = c.Rate, 0
+	if rangeSpec != "" {
+		var err error
+		if c.FindFrom, c.FindTo, err = parseRateRange(rangeSpec); err != nil {
+			return fmt.Errorf("invalid find-range: %w", err)
+		}
+
+		// A single rate is only the start; the search has no upper bound.
+		if !strings.Contains(rangeSpec, "..") {
+			c.FindTo = 0
+		}
+	}
+
+	if c.FindFrom <= 0 {
+		c.FindFrom = c.FindStep
+	}
+
+	if c.FindMax == SearchBinary && c.FindTo <= c.FindFrom {
+		return errors.New("binary find-max requires find-range from..to with to > from")
+	}
+
+	if c.FindTo != 0 && c.FindTo < c.FindFrom {
+		return errors.New("invalid find-range: to must be >= from")
+	}
+
+	return nil
+}
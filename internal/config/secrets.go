@@ -0,0 +1,65 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvLookupBindPass is the environment variable read for the lookup password
+// when neither --lookup-bind-pass nor --lookup-bind-pass-file is set.
+const EnvLookupBindPass = "LDAPBENCH_LOOKUP_BIND_PASS"
+
+// Redacted replaces secret values in reports and logs.
+const Redacted = "REDACTED"
+
+// secretFlags lists flags whose values are redacted in Settings.
+var secretFlags = map[string]bool{
+	"lookup-bind-pass": true,
+}
+
+// loadLookupPass resolves the lookup password: --lookup-bind-pass, else the
+// contents of --lookup-bind-pass-file, else $LDAPBENCH_LOOKUP_BIND_PASS.
+func (c *Config) loadLookupPass() error {
+	if c.LookupBindPassFile == "" {
+		if c.LookupBindPass == "" {
+			c.LookupBindPass = os.Getenv(EnvLookupBindPass)
+		}
+
+		return nil
+	}
+
+	if c.LookupBindPass != "" {
+		return errors.New("lookup-bind-pass and lookup-bind-pass-file are mutually exclusive")
+	}
+
+	data, err := os.ReadFile(c.LookupBindPassFile)
+	if err != nil {
+		return fmt.Errorf("read lookup-bind-pass-file: %w", err)
+	}
+
+	// Strip the trailing newline editors and echo add, as for CSV passwords.
+	c.LookupBindPass = strings.TrimRight(string(data), "\r\n")
+	if c.LookupBindPass == "" {
+		return fmt.Errorf("lookup-bind-pass-file %s is empty", c.LookupBindPassFile)
+	}
+
+	return nil
+}
+
+// Redact replaces every occurrence of the lookup password and of the given
+// secrets (e.g. user passwords) in s with Redacted. Empty secrets are ignored.
+func (c *Config) Redact(s string, secrets ...string) string {
+	if c.LookupBindPass != "" {
+		s = strings.ReplaceAll(s, c.LookupBindPass, Redacted)
+	}
+
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, Redacted)
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestLoadLookupPass(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "pass")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		env     string
+		want    string
+		wantErr string
+	}{
+		{name: "flag", cfg: Config{LookupBindPass: "from-flag"}, env: "from-env", want: "from-flag"},
+		{name: "file", cfg: Config{LookupBindPassFile: file}, env: "from-env", want: "from-file"},
+		{name: "env", env: "from-env", want: "from-env"},
+		{name: "none"},
+		{name: "flag and file", cfg: Config{LookupBindPass: "x", LookupBindPassFile: file}, wantErr: "mutually exclusive"},
+		{name: "empty file", cfg: Config{LookupBindPassFile: empty}, wantErr: "is empty"},
+		{name: "missing file", cfg: Config{LookupBindPassFile: filepath.Join(dir, "missing")}, wantErr: "read lookup-bind-pass-file"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(EnvLookupBindPass, tc.env)
+
+			err := tc.cfg.loadLookupPass()
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil || tc.cfg.LookupBindPass != tc.want {
+				t.Fatalf("got %q (%v), want %q", tc.cfg.LookupBindPass, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	c := &Config{LookupBindPass: "s3cret"}
+
+	got := c.Redact("bind s3cret failed for pw1 and pw2", "pw1", "", "pw2")
+	if got != "bind REDACTED failed for REDACTED and REDACTED" {
+		t.Fatalf("unexpected redaction: %q", got)
+	}
+}
+
+func TestSettingsRedactsPasswordInOtherFlags(t *testing.T) {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.String("lookup-bind-pass", "", "")
+	fs.String("compare-value", "", "")
+	if err := fs.Parse([]string{"--lookup-bind-pass=s3cret", "--compare-value={x}s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := (&Config{LookupBindPass: "s3cret", flags: fs}).Settings()
+	if got["lookup-bind-pass"] != Redacted || got["compare-value"] != "{x}"+Redacted {
+		t.Fatalf("unexpected settings: %v", got)
+	}
+}
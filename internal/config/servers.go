@@ -0,0 +1,115 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ServerPolicy selects the server of each new user connection when several
+// LDAP servers are configured.
+type ServerPolicy string
+
+const (
+	// ServerRoundRobin cycles through the servers.
+	ServerRoundRobin ServerPolicy = "round-robin"
+	// ServerRandom picks a server at random.
+	ServerRandom ServerPolicy = "random"
+	// ServerLeastInFlight picks the server with the fewest requests in
+	// flight.
+	ServerLeastInFlight ServerPolicy = "least-inflight"
+)
+
+// lookupSRV resolves DNS SRV records; tests replace it.
+var lookupSRV = net.LookupSRV
+
+// setServers sets LDAPURLs from the comma-separated --ldap-url list or, when
+// srv is set, from the DNS SRV records of srv.
+func (c *Config) setServers(urls, srv string, urlsSet bool) error {
+	if srv != "" {
+		if urlsSet {
+			return errors.New("ldap-url and ldap-srv are mutually exclusive")
+		}
+
+		resolved, err := resolveSRV(srv)
+		if err != nil {
+			return err
+		}
+
+		c.LDAPURLs = resolved
+
+		return nil
+	}
+
+	c.LDAPURLs = nil
+	for _, raw := range strings.Split(urls, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+
+		u, err := url.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("invalid ldap-url %q: %w", raw, err)
+		}
+
+		switch u.Scheme {
+		case "ldap", "ldaps", "ldapi":
+		default:
+			return fmt.Errorf("invalid ldap-url %q: scheme must be ldap, ldaps, or ldapi", raw)
+		}
+
+		c.LDAPURLs = append(c.LDAPURLs, raw)
+	}
+
+	if len(c.LDAPURLs) == 0 {
+		return errors.New("ldap-url is required")
+	}
+
+	return nil
+}
+
+// resolveSRV returns one URL per SRV target of name, in the order of their
+// priority and weight. A bare domain is looked up as _ldap._tcp.<domain>; a
+// full record name such as _ldaps._tcp.example.com is used as is, and
+// _ldaps records yield ldaps:// URLs.
+func resolveSRV(name string) ([]string, error) {
+	var (
+		addrs []*net.SRV
+		err   error
+	)
+
+	if strings.HasPrefix(name, "_") {
+		_, addrs, err = lookupSRV("", "", name)
+	} else {
+		_, addrs, err = lookupSRV("ldap", "tcp", name)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("ldap-srv %s: %w", name, err)
+	}
+
+	scheme := "ldap"
+	if strings.HasPrefix(name, "_ldaps.") {
+		scheme = "ldaps"
+	}
+
+	urls := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		host := strings.TrimSuffix(a.Target, ".")
+		if host == "" {
+			continue
+		}
+
+		urls = append(urls, scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(a.Port))))
+	}
+
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("ldap-srv %s: no servers found", name)
+	}
+
+	return urls, nil
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetServers(t *testing.T) {
+	old := lookupSRV
+	t.Cleanup(func() { lookupSRV = old })
+
+	var gotService, gotName string
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		gotService, gotName = service, name
+		if name == "missing.example.com" {
+			return "", nil, errors.New("no such host")
+		}
+
+		return "", []*net.SRV{{Target: "ldap1.example.com.", Port: 389}, {Target: "ldap2.example.com.", Port: 3389}}, nil
+	}
+
+	tests := []struct {
+		name    string
+		urls    string
+		srv     string
+		urlsSet bool
+		want    []string
+		wantErr string
+	}{
+		{name: "single", urls: "ldap://localhost:389", want: []string{"ldap://localhost:389"}},
+		{name: "list", urls: "ldaps://a:636, ldap://b ,ldapi://", want: []string{"ldaps://a:636", "ldap://b", "ldapi://"}},
+		{name: "srv domain", urls: "ldap://localhost:389", srv: "example.com", want: []string{"ldap://ldap1.example.com:389", "ldap://ldap2.example.com:3389"}},
+		{name: "srv ldaps record", srv: "_ldaps._tcp.example.com", want: []string{"ldaps://ldap1.example.com:389", "ldaps://ldap2.example.com:3389"}},
+		{name: "bad scheme", urls: "ldap://a,http://b", wantErr: `invalid ldap-url "http://b"`},
+		{name: "empty", urls: " , ", wantErr: "ldap-url is required"},
+		{name: "both", urls: "ldap://a", srv: "example.com", urlsSet: true, wantErr: "mutually exclusive"},
+		{name: "srv error", srv: "missing.example.com", wantErr: "ldap-srv missing.example.com: no such host"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var c Config
+
+			err := c.setServers(tc.urls, tc.srv, tc.urlsSet)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil || !reflect.DeepEqual(c.LDAPURLs, tc.want) {
+				t.Fatalf("LDAPURLs = %v (%v), want %v", c.LDAPURLs, err, tc.want)
+			}
+		})
+	}
+
+	var c Config
+	if err := c.setServers("", "example.com", false); err != nil || gotService != "ldap" || gotName != "example.com" {
+		t.Fatalf("domain looked up as service=%q name=%q (%v)", gotService, gotName, err)
+	}
+
+	if err := c.setServers("", "_ldap._tcp.example.com", false); err != nil || gotService != "" || gotName != "_ldap._tcp.example.com" {
+		t.Fatalf("record looked up as service=%q name=%q (%v)", gotService, gotName, err)
+	}
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stage is one segment of a load profile. A profile runs its stages in order;
+// each stage has its own duration, target rate and number of workers.
+type Stage struct {
+	Name        string
+	Duration    time.Duration
+	Rate        float64 // target requests per second at the start; 0 = unlimited (closed loop only)
+	RateEnd     float64 // target at the end of a linear ramp; equals Rate for a constant stage
+	Concurrency int
+}
+
+// RateAt returns the target rate after elapsed time within the stage.
+func (s Stage) RateAt(elapsed time.Duration) float64 {
+	if s.RateEnd == s.Rate || s.Duration <= 0 {
+		return s.Rate
+	}
+
+	f := min(max(float64(elapsed)/float64(s.Duration), 0), 1)
+
+	return s.Rate + (s.RateEnd-s.Rate)*f
+}
+
+// ParseStages parses a load profile such as
+//
+//	"name=warm,duration=30s,rate=100; duration=2m,rate=100..1000,concurrency=64"
+//
+// Stages are separated by ';' and consist of comma-separated key=value pairs:
+// duration (required), rate (a number or from..to for a linear ramp),
+// concurrency and name. Missing rates and concurrencies default to rate and
+// concurrency; missing names to stage1, stage2, ...
+func ParseStages(s string, rate float64, concurrency int) ([]Stage, error) {
+	var stages []Stage
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		st := Stage{Name: fmt.Sprintf("stage%d", len(stages)+1), Rate: rate, RateEnd: rate, Concurrency: concurrency}
+		for _, kv := range strings.Split(part, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid stage %q: expected key=value, got %q", part, kv)
+			}
+
+			var err error
+			switch strings.TrimSpace(key) {
+			case "name":
+				st.Name = strings.TrimSpace(value)
+			case "duration":
+				st.Duration, err = time.ParseDuration(strings.TrimSpace(value))
+			case "rate":
+				st.Rate, st.RateEnd, err = parseRateRange(value)
+			case "concurrency":
+				st.Concurrency, err = strconv.Atoi(strings.TrimSpace(value))
+			default:
+				err = fmt.Errorf("unknown key %q", key)
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid stage %q: %w", part, err)
+			}
+		}
+
+		switch {
+		case st.Duration <= 0:
+			return nil, fmt.Errorf("invalid stage %q: duration must be > 0", part)
+		case st.Concurrency <= 0:
+			return nil, fmt.Errorf("invalid stage %q: concurrency must be >= 1", part)
+		case st.Rate < 0 || st.RateEnd < 0:
+			return nil, fmt.Errorf("invalid stage %q: rate must be >= 0", part)
+		case st.Name == "" || seen[st.Name]:
+			return nil, fmt.Errorf("invalid stage %q: names must be unique and non-empty", part)
+		}
+
+		seen[st.Name] = true
+		stages = append(stages, st)
+	}
+
+	if len(stages) == 0 {
+		return nil, errors.New("stages must contain at least one stage")
+	}
+
+	return stages, nil
+}
+
+// RampStages returns a single stage ramping linearly over duration, e.g. from
+// "100..1000".
+func RampStages(s string, duration time.Duration, concurrency int) ([]Stage, error) {
+	from, to, err := parseRateRange(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ramp %q: %w", s, err)
+	}
+
+	if from <= 0 || to <= 0 {
+		return nil, fmt.Errorf("invalid ramp %q: rates must be > 0", s)
+	}
+
+	return []Stage{{Name: "ramp", Duration: duration, Rate: from, RateEnd: to, Concurrency: concurrency}}, nil
+}
+
+// StepStages splits duration into stages of a fixed length whose rate grows by
+// a fixed increment, e.g. "100/30s" starts at rate (or 100 when rate is 0)
+// and adds 100 every 30 seconds.
+func StepStages(s string, rate float64, duration time.Duration, concurrency int) ([]Stage, error) {
+	inc, every, ok := strings.Cut(s, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid step %q: expected increment/interval, e.g. 100/30s", s)
+	}
+
+	step, err := strconv.ParseFloat(strings.TrimSpace(inc), 64)
+	if err != nil || step <= 0 {
+		return nil, fmt.Errorf("invalid step %q: increment must be > 0", s)
+	}
+
+	interval, err := time.ParseDuration(strings.TrimSpace(every))
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("invalid step %q: interval must be a duration > 0", s)
+	}
+
+	if rate <= 0 {
+		rate = step
+	}
+
+	var stages []Stage
+	for left := duration; left > 0; left -= interval {
+		r := rate + step*float64(len(stages))
+		stages = append(stages, Stage{
+			Name:        fmt.Sprintf("step%d", len(stages)+1),
+			Duration:    min(interval, left),
+			Rate:        r,
+			RateEnd:     r,
+			Concurrency: concurrency,
+		})
+	}
+
+	return stages, nil
+}
+
+// parseRateRange parses "n" or "from..to".
+func parseRateRange(s string) (from, to float64, err error) {
+	a, b, isRange := strings.Cut(strings.TrimSpace(s), "..")
+	if from, err = strconv.ParseFloat(strings.TrimSpace(a), 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid rate %q", s)
+	}
+
+	if !isRange {
+		return from, from, nil
+	}
+
+	if to, err = strconv.ParseFloat(strings.TrimSpace(b), 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid rate %q", s)
+	}
+
+	return from, to, nil
+}
+
+// setStages builds the load profile from at most one of the --stages, --ramp
+// and --step specifications. With a profile, Duration becomes the sum of the
+// stage durations.
+func (c *Config) setStages(stages, ramp, step string) error {
+	n := 0
+	for _, s := range []string{stages, ramp, step} {
+		if s != "" {
+			n++
+		}
+	}
+
+	if n > 1 {
+		return errors.New("only one of stages, ramp, or step may be set")
+	}
+
+	var err error
+	switch {
+	case stages != "":
+		c.Stages, err = ParseStages(stages, c.Rate, c.Concurrency)
+	case ramp != "":
+		c.Stages, err = RampStages(ramp, c.Duration, c.Concurrency)
+	case step != "":
+		c.Stages, err = StepStages(step, c.Rate, c.Duration, c.Concurrency)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(c.Stages) > 0 {
+		c.Duration = 0
+		for _, st := range c.Stages {
+			c.Duration += st.Duration
+		}
+	}
+
+	return nil
+}
+
+// MaxConcurrency returns the largest number of workers needed by any stage.
+func (c *Config) MaxConcurrency() int {
+	n := c.Concurrency
+	for _, st := range c.Stages {
+		n = max(n, st.Concurrency)
+	}
+
+	return n
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// tlsVersions maps the --tls-min-version/--tls-max-version values.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsCurves maps the lower-cased --tls-curves names, including the aliases
+// used by OpenSSL, to curve IDs.
+var tlsCurves = map[string]tls.CurveID{
+	"x25519mlkem768": tls.X25519MLKEM768,
+	"x25519":         tls.X25519,
+	"p256":           tls.CurveP256,
+	"p-256":          tls.CurveP256,
+	"prime256v1":     tls.CurveP256,
+	"secp256r1":      tls.CurveP256,
+	"p384":           tls.CurveP384,
+	"p-384":          tls.CurveP384,
+	"secp384r1":      tls.CurveP384,
+	"p521":           tls.CurveP521,
+	"p-521":          tls.CurveP521,
+	"secp521r1":      tls.CurveP521,
+}
+
+// setTLS parses the TLS protocol flags and loads the client key pair and CA
+// bundle, so broken TLS material fails at startup with a clear error instead
+// of at the first handshake.
+func (c *Config) setTLS(minVersion, maxVersion, ciphers, curves string) error {
+	var err error
+	if c.TLSMinVersion, err = parseTLSVersion("tls-min-version", minVersion); err != nil {
+		return err
+	}
+
+	if c.TLSMaxVersion, err = parseTLSVersion("tls-max-version", maxVersion); err != nil {
+		return err
+	}
+
+	if c.TLSMinVersion != 0 && c.TLSMaxVersion != 0 && c.TLSMinVersion > c.TLSMaxVersion {
+		return fmt.Errorf("tls-min-version %s is above tls-max-version %s", minVersion, maxVersion)
+	}
+
+	if c.TLSCipherSuites, err = parseCipherSuites(ciphers); err != nil {
+		return err
+	}
+
+	if c.TLSCurves, err = parseCurves(curves); err != nil {
+		return err
+	}
+
+	return c.loadTLSMaterial()
+}
+
+// loadTLSMaterial loads the client key pair and the CA bundle.
+func (c *Config) loadTLSMaterial() error {
+	if (c.TLSCertPath == "") != (c.TLSKeyPath == "") {
+		return errors.New("tls-cert and tls-key must be set together")
+	}
+
+	if c.TLSCertPath != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCertPath, c.TLSKeyPath)
+		if err != nil {
+			return fmt.Errorf("load tls-cert %s / tls-key %s: %w", c.TLSCertPath, c.TLSKeyPath, err)
+		}
+
+		c.tlsCerts = []tls.Certificate{cert}
+	}
+
+	if c.TLSCAFile != "" {
+		pem, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return fmt.Errorf("read tls-ca-file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tls-ca-file %s: no PEM certificates found", c.TLSCAFile)
+		}
+
+		c.tlsRoots = pool
+	}
+
+	return nil
+}
+
+func parseTLSVersion(flag, s string) (uint16, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	v, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("invalid %s %q: must be 1.0, 1.1, 1.2, or 1.3", flag, s)
+	}
+
+	return v, nil
+}
+
+// parseCipherSuites resolves comma-separated cipher suite names as printed by
+// tls.CipherSuiteName. Insecure suites are accepted as they may be needed to
+// reproduce legacy clients.
+func parseCipherSuites(s string) ([]uint16, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	ids := make(map[string]uint16)
+	for _, cs := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		ids[cs.Name] = cs.ID
+	}
+
+	var out []uint16
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+
+		id, ok := ids[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid tls-cipher-suites: unknown cipher suite %q", name)
+		}
+
+		out = append(out, id)
+	}
+
+	return out, nil
+}
+
+func parseCurves(s string) ([]tls.CurveID, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var out []tls.CurveID
+	for _, name := range strings.Split(s, ",") {
+		id, ok := tlsCurves[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("invalid tls-curves: unknown curve %q (known: X25519MLKEM768, X25519, P256, P384, P521)", strings.TrimSpace(name))
+		}
+
+		out = append(out, id)
+	}
+
+	return out, nil
+}
+
+// TLSConfig returns the TLS client configuration for ldaps:// and StartTLS.
+// The key pair and CA bundle are the ones loaded by Parse.
+func (c *Config) TLSConfig() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		Certificates:       c.tlsCerts,
+		RootCAs:            c.tlsRoots,
+		ServerName:         c.TLSServerName,
+		MinVersion:         c.TLSMinVersion,
+		MaxVersion:         c.TLSMaxVersion,
+		CipherSuites:       c.TLSCipherSuites,
+		CurvePreferences:   c.TLSCurves,
+	}
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeKeyPair writes a self-signed certificate and its key as PEM files.
+func writeKeyPair(t *testing.T, dir string) (certPath, keyPath string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldapbench test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath, keyPath = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certPath, keyPath
+}
+
+func TestSetTLS(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := writeKeyPair(t, dir)
+
+	c := &Config{TLSCertPath: cert, TLSKeyPath: key, TLSCAFile: cert, TLSServerName: "ldap.example.com"}
+	if err := c.setTLS("1.2", "TLS1.3", "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls_ecdhe_rsa_with_aes_256_gcm_sha384", "X25519,p-256"); err != nil {
+		t.Fatalf("setTLS: %v", err)
+	}
+
+	tc := c.TLSConfig()
+	if tc.MinVersion != tls.VersionTLS12 || tc.MaxVersion != tls.VersionTLS13 || tc.ServerName != "ldap.example.com" {
+		t.Fatalf("unexpected versions/server name: %+v", tc)
+	}
+
+	if len(tc.Certificates) != 1 || tc.RootCAs == nil {
+		t.Fatalf("expected key pair and CA pool to be loaded")
+	}
+
+	if want := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}; !reflect.DeepEqual(tc.CipherSuites, want) {
+		t.Fatalf("cipher suites = %v, want %v", tc.CipherSuites, want)
+	}
+
+	if want := []tls.CurveID{tls.X25519, tls.CurveP256}; !reflect.DeepEqual(tc.CurvePreferences, want) {
+		t.Fatalf("curves = %v, want %v", tc.CurvePreferences, want)
+	}
+}
+
+func TestSetTLS_Errors(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := writeKeyPair(t, dir)
+
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                 string
+		cfg                  Config
+		min, max, ciph, curv string
+		want                 string
+	}{
+		{name: "version", min: "1.4", want: `invalid tls-min-version "1.4"`},
+		{name: "version order", min: "1.3", max: "1.2", want: "tls-min-version 1.3 is above tls-max-version 1.2"},
+		{name: "cipher", ciph: "TLS_RSA_WITH_NOTHING", want: `unknown cipher suite "TLS_RSA_WITH_NOTHING"`},
+		{name: "curve", curv: "brainpool", want: `unknown curve "brainpool"`},
+		{name: "cert without key", cfg: Config{TLSCertPath: cert}, want: "must be set together"},
+		{name: "key mismatch", cfg: Config{TLSCertPath: cert, TLSKeyPath: garbage}, want: "load tls-cert"},
+		{name: "missing ca", cfg: Config{TLSCAFile: filepath.Join(dir, "missing.pem")}, want: "read tls-ca-file"},
+		{name: "no certs in ca", cfg: Config{TLSCAFile: garbage}, want: "no PEM certificates found"},
+		{name: "valid", cfg: Config{TLSCertPath: cert, TLSKeyPath: key}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.setTLS(tc.min, tc.max, tc.ciph, tc.curv)
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
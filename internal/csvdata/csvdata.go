@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -15,17 +16,47 @@ import (
 type User struct {
 	Username string
 	Password string
-	// ExpectedOK reflects optional CSV column `expected_ok`.
-	// When the column exists, only rows with true are included by Load.
-	ExpectedOK bool
+
+	// DN is the user's entry from the optional CSV column `dn`. When set,
+	// it is used instead of searching the entry by username.
+	DN string
+	// ExpectFail marks a negative test case whose iterations are expected to
+	// fail: the optional CSV column `expected_ok` is false. An absent or empty
+	// column keeps the default expectation of success.
+	ExpectFail bool
+	// ExpectedCode is the LDAP result code a negative test case must fail
+	// with, from the optional column `expected_result_code`; 0 accepts any
+	// failure.
+	ExpectedCode int
+	// Weight is the relative selection weight from the optional CSV column
+	// `weight`; 1 when the column is absent.
+	Weight float64
+	// Columns holds every column of the row keyed by its lower-cased header
+	// name. It is used to expand "{column}" placeholders in templates.
+	Columns map[string]string
 }
 
 // Users holds all parsed users.
 type Users struct {
 	All []User
+	// Weighted is true when the CSV has a weight column.
+	Weighted bool
+}
+
+// MissingDN reports whether a user has no DN in the CSV and therefore needs
+// its DN built from a template or searched.
+func (u *Users) MissingDN() bool {
+	for _, user := range u.All {
+		if user.DN == "" {
+			return true
+		}
+	}
+
+	return false
 }
 
-// Load reads a CSV file and returns all users. Additional columns are ignored.
+// Load reads a CSV file and returns all users. Additional columns are kept in
+// User.Columns; an optional weight column sets User.Weight.
 func Load(path string) (*Users, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -41,9 +72,11 @@ func Load(path string) (*Users, error) {
 		return nil, fmt.Errorf("read header: %w", err)
 	}
 
-	idxU, idxP, idxOK := -1, -1, -1
+	idxU, idxP, idxOK, idxW, idxCode, idxDN := -1, -1, -1, -1, -1, -1
+	names := make([]string, len(h))
 	for i, name := range h {
 		col := strings.TrimSpace(strings.ToLower(name))
+		names[i] = col
 		switch col {
 		case "username":
 			idxU = i
@@ -51,6 +84,12 @@ func Load(path string) (*Users, error) {
 			idxP = i
 		case "expected_ok":
 			idxOK = i
+		case "weight":
+			idxW = i
+		case "expected_result_code":
+			idxCode = i
+		case "dn":
+			idxDN = i
 		}
 	}
 
@@ -59,6 +98,7 @@ func Load(path string) (*Users, error) {
 	}
 
 	var users []User
+	var total float64
 	for {
 		rec, err := r.Read()
 		if err == io.EOF {
@@ -74,25 +114,127 @@ func Load(path string) (*Users, error) {
 		}
 
 		// Trim username and strip trailing CR/LF from password to avoid CSV line-ending artifacts
-		u := User{Username: strings.TrimSpace(rec[idxU]), Password: strings.TrimRight(rec[idxP], "\r\n")}
+		u := User{Username: strings.TrimSpace(rec[idxU]), Password: strings.TrimRight(rec[idxP], "\r\n"), DN: field(rec, idxDN), Weight: 1}
+
+		u.Columns = make(map[string]string, len(names))
+		for i, name := range names {
+			if i < len(rec) && name != "" {
+				u.Columns[name] = rec[i]
+			}
+		}
+
+		// expected_ok=false marks a negative test case; an empty value keeps
+		// the default expectation of success.
+		if val := field(rec, idxOK); val != "" {
+			ok, err := parseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("user %s: invalid expected_ok %q", u.Username, val)
+			}
+
+			u.ExpectFail = !ok
+		}
 
-		// If expected_ok column exists, parse and filter accordingly.
-		if idxOK >= 0 {
-			val := ""
-			if idxOK < len(rec) {
-				val = rec[idxOK]
+		if val := field(rec, idxCode); val != "" {
+			code, err := strconv.Atoi(val)
+			if err != nil || code <= 0 {
+				return nil, fmt.Errorf("user %s: invalid expected_result_code %q", u.Username, val)
 			}
 
-			if strings.EqualFold(strings.TrimSpace(val), "true") {
-				u.ExpectedOK = true
-			} else {
-				// Skip row when column exists and not explicitly true
-				continue
+			u.ExpectedCode = code
+		}
+
+		if idxW >= 0 {
+			val := field(rec, idxW)
+			w, err := strconv.ParseFloat(val, 64)
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("user %s: invalid weight %q", u.Username, val)
 			}
+
+			u.Weight = w
 		}
 
+		total += u.Weight
 		users = append(users, u)
 	}
 
-	return &Users{All: users}, nil
+	if idxW >= 0 && len(users) > 0 && total <= 0 {
+		return nil, fmt.Errorf("weight column must contain a value > 0")
+	}
+
+	return &Users{All: users, Weighted: idxW >= 0}, nil
+}
+
+// parseBool parses the values of strconv.ParseBool plus yes and no.
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	default:
+		return strconv.ParseBool(s)
+	}
+}
+
+// field returns the trimmed value of column i of rec, or "" when the column
+// is absent (i < 0) or missing in the row.
+func field(rec []string, i int) string {
+	if i < 0 || i >= len(rec) {
+		return ""
+	}
+
+	return strings.TrimSpace(rec[i])
+}
+
+// Expand substitutes placeholders in tmpl for this user: "%s" is replaced with
+// the username and "{column}" with the value of the named CSV column (header
+// names are matched case-insensitively). Unknown placeholders are kept verbatim.
+func (u User) Expand(tmpl string) string {
+	s := strings.ReplaceAll(tmpl, "%s", u.Username)
+	if !strings.Contains(s, "{") {
+		return s
+	}
+
+	var b strings.Builder
+	for {
+		open := strings.IndexByte(s, '{')
+		if open < 0 {
+			break
+		}
+
+		end := strings.IndexByte(s[open:], '}')
+		if end < 0 {
+			break
+		}
+
+		end += open
+		b.WriteString(s[:open])
+
+		if val, ok := u.column(strings.ToLower(s[open+1 : end])); ok {
+			b.WriteString(val)
+		} else {
+			b.WriteString(s[open : end+1])
+		}
+
+		s = s[end+1:]
+	}
+
+	b.WriteString(s)
+
+	return b.String()
+}
+
+// column returns the value of a CSV column. Username and password resolve to
+// the normalized fields so templates see the same values as bind operations.
+func (u User) column(name string) (string, bool) {
+	switch name {
+	case "username":
+		return u.Username, true
+	case "password":
+		return u.Password, true
+	}
+
+	val, ok := u.Columns[name]
+
+	return val, ok
 }
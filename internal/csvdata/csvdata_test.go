@@ -45,15 +45,106 @@ func TestLoad_HeaderError(t *testing.T) {
 	}
 }
 
-func TestLoad_ExpectedOKFilter(t *testing.T) {
-	p := writeTemp(t, "username,password,expected_ok\nu1,p1,true\nu2,p2,false\n")
+func TestLoad_ExpectedOK(t *testing.T) {
+	p := writeTemp(t, "username,password,expected_ok,expected_result_code\nu1,p1,true,\nu2,p2,false,49\nu3,p3,,\nu4,p4,FALSE,\nu5,p5, 0 ,\nu6,p6,yes,\nu7,p7,No,\n")
 
 	u, err := Load(p)
 	if err != nil {
 		t.Fatalf("Load error: %v", err)
 	}
 
-	if len(u.All) != 1 || u.All[0].Username != "u1" || !u.All[0].ExpectedOK {
-		t.Fatalf("unexpected filter result: %+v", u.All)
+	want := []struct {
+		fail bool
+		code int
+	}{{false, 0}, {true, 49}, {false, 0}, {true, 0}, {true, 0}, {false, 0}, {true, 0}}
+
+	if len(u.All) != len(want) {
+		t.Fatalf("expected negative rows to be loaded, got %+v", u.All)
+	}
+
+	for i, w := range want {
+		if u.All[i].ExpectFail != w.fail || u.All[i].ExpectedCode != w.code {
+			t.Fatalf("row %d: expect_fail=%v code=%d, want %v/%d", i, u.All[i].ExpectFail, u.All[i].ExpectedCode, w.fail, w.code)
+		}
+	}
+
+	for _, content := range []string{"username,password,expected_ok\nu1,p1,maybe\n", "username,password,expected_ok\nu1,p1,off\n", "username,password,expected_result_code\nu1,p1,x\n"} {
+		if _, err := Load(writeTemp(t, content)); err == nil {
+			t.Fatalf("expected error for %q", content)
+		}
+	}
+}
+
+func TestLoad_DN(t *testing.T) {
+	u, err := Load(writeTemp(t, "username,password,DN\nu1,p1,\"uid=u1\\,x,ou=people,dc=example,dc=org \"\n"))
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+
+	if got := u.All[0].DN; got != `uid=u1\,x,ou=people,dc=example,dc=org` {
+		t.Fatalf("dn = %q", got)
+	}
+
+	if u.MissingDN() {
+		t.Fatal("expected every user to have a DN")
+	}
+
+	u, err = Load(writeTemp(t, "username,password,dn\nu1,p1,\"uid=u1,dc=org\"\nu2,p2,\n"))
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+
+	if !u.MissingDN() {
+		t.Fatal("expected a user without DN")
+	}
+}
+
+func TestLoad_ColumnsAndExpand(t *testing.T) {
+	p := writeTemp(t, "username,password,Mail\nu1,p1,u1@example.org\n")
+
+	u, err := Load(p)
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"%s", "u1"},
+		{"{password}", "p1"},
+		{"{mail}", "u1@example.org"},
+		{"uid=%s,{MAIL}", "uid=u1,u1@example.org"},
+		{"{unknown}", "{unknown}"},
+		{"{unterminated", "{unterminated"},
+	}
+
+	for _, tt := range tests {
+		if got := u.All[0].Expand(tt.tmpl); got != tt.want {
+			t.Fatalf("Expand(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestLoad_Weights(t *testing.T) {
+	p := writeTemp(t, "username,password,weight\nu1,p1,2.5\nu2,p2,0\n")
+
+	u, err := Load(p)
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+
+	if !u.Weighted || u.All[0].Weight != 2.5 || u.All[1].Weight != 0 {
+		t.Fatalf("unexpected weights: %+v", u)
+	}
+
+	if u, _ := Load(writeTemp(t, "username,password\nu1,p1\n")); u.Weighted || u.All[0].Weight != 1 {
+		t.Fatalf("expected default weight 1 without column: %+v", u)
+	}
+
+	for _, content := range []string{"username,password,weight\nu1,p1,x\n", "username,password,weight\nu1,p1,-1\n", "username,password,weight\nu1,p1,0\n"} {
+		if _, err := Load(writeTemp(t, content)); err == nil {
+			t.Fatalf("expected error for %q", content)
+		}
 	}
 }
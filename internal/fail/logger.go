@@ -5,6 +5,7 @@ package fail
 import (
 	"encoding/csv"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -12,11 +13,15 @@ import (
 // Record describes a failed attempt.
 type Record struct {
 	Timestamp time.Time
-	Operation string // lookup|bind|search
+	Operation string // lookup|bind|search|compare|modify|add|delete|passwd|passwd-policy
 	Username  string
 	DN        string
-	Filter    string
+	Filter    string // search filter, or the attribute for compare/modify
 	Error     string
+	// ResultCode is the numeric LDAP result code (e.g. 49 for
+	// invalidCredentials, 200 for go-ldap network errors); 0 when the error
+	// carries none, written as an empty field.
+	ResultCode int
 }
 
 // Logger writes failure records to a CSV file in batches.
@@ -85,7 +90,7 @@ func (l *Logger) run() {
 
 	w := csv.NewWriter(f)
 	// Write header
-	_ = w.Write([]string{"timestamp", "operation", "username", "dn", "filter", "error"})
+	_ = w.Write([]string{"timestamp", "operation", "username", "dn", "filter", "error", "result_code"})
 	w.Flush()
 
 	buf := make([]Record, 0, l.batch)
@@ -95,8 +100,13 @@ func (l *Logger) run() {
 		}
 
 		for _, r := range buf {
+			code := ""
+			if r.ResultCode != 0 {
+				code = strconv.Itoa(r.ResultCode)
+			}
+
 			_ = w.Write([]string{
-				r.Timestamp.Format(time.RFC3339Nano), r.Operation, r.Username, r.DN, r.Filter, r.Error,
+				r.Timestamp.Format(time.RFC3339Nano), r.Operation, r.Username, r.DN, r.Filter, r.Error, code,
 			})
 		}
 
@@ -20,7 +20,7 @@ func TestLogger_WriteAndClose(t *testing.T) {
 
 	// enqueue a few records
 	l.Log(Record{Timestamp: time.Now(), Operation: "lookup", Username: "u", DN: "dn", Error: "e"})
-	l.Log(Record{Timestamp: time.Now(), Operation: "bind", Username: "u2", DN: "dn2", Error: "e2"})
+	l.Log(Record{Timestamp: time.Now(), Operation: "bind", Username: "u2", DN: "dn2", Error: "e2", ResultCode: 49})
 
 	// ensure flush on close
 	l.Close()
@@ -47,7 +47,11 @@ func TestLogger_WriteAndClose(t *testing.T) {
 		t.Fatalf("expected at least 3 lines, got %d", len(lines))
 	}
 
-	if want := "timestamp,operation,username,dn,filter,error"; !strings.Contains(lines[0], want) {
+	if want := "timestamp,operation,username,dn,filter,error,result_code"; !strings.Contains(lines[0], want) {
 		t.Fatalf("missing header, got: %q", lines[0])
 	}
+
+	if !strings.HasSuffix(lines[1], ",e,") || !strings.HasSuffix(lines[2], ",e2,49") {
+		t.Fatalf("unexpected result_code fields: %q", lines[1:])
+	}
 }
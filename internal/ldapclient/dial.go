@@ -0,0 +1,131 @@
+package ldapclient
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/croessner/ldapbench/internal/metrics"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// dial opens a connection to s according to the URL scheme (ldap://, ldaps:// or
+// ldapi://). Connecting and the TLS handshake are performed separately so the
+// dial and tls phases can be measured on their own. StartTLS is only applied
+// on plain ldap://; ldaps:// uses TLS from the start and ldapi:// (Unix domain
+// socket) does not support StartTLS.
+func (c *client) dial(s *server) (*ldap.Conn, error) {
+	u := s.u
+
+	network, addr, host, err := endpoint(u)
+	if err != nil {
+		return nil, ldap.NewError(ldap.ErrorNetwork, err)
+	}
+
+	d := &net.Dialer{Timeout: c.cfg.Timeout}
+
+	start := time.Now()
+	conn, err := d.Dial(network, addr)
+	c.observe(metrics.PhaseDial, start, err)
+	if err != nil {
+		return nil, ldap.NewError(ldap.ErrorNetwork, &setupError{class: ClassDial, err: err})
+	}
+
+	isTLS := u.Scheme == "ldaps"
+	if isTLS {
+		tc := c.cfg.TLSConfig()
+		if tc.ServerName == "" {
+			tc.ServerName = host
+		}
+
+		tlsConn := tls.Client(conn, tc)
+
+		start = time.Now()
+		err = handshake(tlsConn, c.cfg.Timeout)
+		c.observe(metrics.PhaseTLS, start, err)
+		if err != nil {
+			conn.Close()
+
+			return nil, ldap.NewError(ldap.ErrorNetwork, &setupError{class: ClassTLS, err: err})
+		}
+
+		conn = tlsConn
+	}
+
+	l := ldap.NewConn(conn, isTLS)
+	l.Start()
+
+	if c.cfg.StartTLS && u.Scheme == "ldap" {
+		tc := c.cfg.TLSConfig()
+		if tc.ServerName == "" {
+			tc.ServerName = host
+		}
+
+		start = time.Now()
+		err = l.StartTLS(tc)
+		c.observe(metrics.PhaseTLS, start, err)
+		if err != nil {
+			l.Close()
+
+			return nil, ldap.NewError(ldap.ErrorNetwork, &setupError{class: ClassTLS, err: err})
+		}
+	}
+
+	l.SetTimeout(c.cfg.Timeout)
+
+	if c.m != nil {
+		c.m.OpenConns.Add(1)
+	}
+
+	return l, nil
+}
+
+// handshake runs the TLS handshake bounded by timeout (0 = no deadline).
+func handshake(conn *tls.Conn, timeout time.Duration) error {
+	if timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return err
+		}
+
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	return conn.Handshake()
+}
+
+// endpoint returns the network, dial address and host name for an LDAP URL,
+// applying the same defaults as go-ldap's DialURL.
+func endpoint(u *url.URL) (network, addr, host string, err error) {
+	if u.Scheme == "ldapi" {
+		path := u.Path
+		if path == "" || path == "/" {
+			path = "/var/run/slapd/ldapi"
+		}
+
+		return "unix", path, "", nil
+	}
+
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		// we assume that error is due to missing port
+		host = u.Host
+		port = ""
+	}
+
+	switch u.Scheme {
+	case "ldap":
+		if port == "" {
+			port = ldap.DefaultLdapPort
+		}
+	case "ldaps":
+		if port == "" {
+			port = ldap.DefaultLdapsPort
+		}
+	default:
+		return "", "", "", fmt.Errorf("unknown scheme '%s'", u.Scheme)
+	}
+
+	return "tcp", net.JoinHostPort(host, port), host, nil
+}
@@ -0,0 +1,156 @@
+package ldapclient
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// dnCache maps usernames to DNs like the caches of authentication front-ends.
+// Entries expire ttl after they were stored; beyond size entries the least
+// recently used one is evicted.
+type dnCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	lru     *list.List // of *dnEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type dnEntry struct {
+	username string
+	dn       string
+	expires  time.Time
+}
+
+func newDNCache(ttl time.Duration, size int) *dnCache {
+	return &dnCache{ttl: ttl, size: size, lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns the DN of username when it is cached and not expired at now.
+func (d *dnCache) get(username string, now time.Time) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	el, ok := d.entries[username]
+	if !ok {
+		return "", false
+	}
+
+	e := el.Value.(*dnEntry)
+	if !now.Before(e.expires) {
+		d.lru.Remove(el)
+		delete(d.entries, username)
+
+		return "", false
+	}
+
+	d.lru.MoveToFront(el)
+
+	return e.dn, true
+}
+
+// put stores the DN of username at now, evicting the least recently used
+// entry when the cache is full.
+func (d *dnCache) put(username, dn string, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if el, ok := d.entries[username]; ok {
+		e := el.Value.(*dnEntry)
+		e.dn, e.expires = dn, now.Add(d.ttl)
+		d.lru.MoveToFront(el)
+
+		return
+	}
+
+	if d.lru.Len() >= d.size {
+		oldest := d.lru.Back()
+		d.lru.Remove(oldest)
+		delete(d.entries, oldest.Value.(*dnEntry).username)
+	}
+
+	d.entries[username] = d.lru.PushFront(&dnEntry{username: username, dn: dn, expires: now.Add(d.ttl)})
+}
+
+// len returns the number of cached entries, including expired ones not yet
+// removed.
+func (d *dnCache) len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.lru.Len()
+}
+
+// cachedDN looks username up in the DN cache and counts the hit or miss.
+func (c *client) cachedDN(username string) (string, bool) {
+	dn, ok := c.dns.get(username, time.Now())
+	if c.m != nil {
+		if ok {
+			c.m.Bucket().DNCacheHits.Add(1)
+		} else {
+			c.m.Bucket().DNCacheMisses.Add(1)
+		}
+	}
+
+	return dn, ok
+}
+
+// PrewarmDNs searches the DNs of usernames on all lookup connections in
+// parallel and stores them in the DN cache, so the measured phase starts with
+// a warm cache. Nothing is recorded into the metrics. Users that do not exist
+// are skipped; any other error stops the prewarming. It returns the number of
+// cached DNs.
+func (c *client) PrewarmDNs(usernames []string) (int, error) {
+	if c.dns == nil {
+		return 0, nil
+	}
+
+	var (
+		wg      sync.WaitGroup
+		next    atomic.Int64
+		failed  atomic.Bool
+		errOnce sync.Once
+		first   error
+	)
+
+	for range cap(c.lookups) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for !failed.Load() {
+				i := int(next.Add(1) - 1)
+				if i >= len(usernames) {
+					return
+				}
+
+				var dn string
+				err := c.useLookup(false, func(l *ldap.Conn) error {
+					var err error
+					dn, err = c.searchDN(l, usernames[i])
+
+					return err
+				})
+
+				switch {
+				case err == nil:
+					c.dns.put(usernames[i], dn, time.Now())
+				case !errors.Is(err, ErrUserNotFound):
+					errOnce.Do(func() { first = fmt.Errorf("user %s: %w", usernames[i], err) })
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return c.dns.len(), first
+}
@@ -0,0 +1,70 @@
+package ldapclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/croessner/ldapbench/internal/metrics"
+)
+
+func TestDNCache(t *testing.T) {
+	now := time.Now()
+	d := newDNCache(time.Minute, 2)
+
+	d.put("a", "uid=a", now)
+	d.put("b", "uid=b", now)
+
+	// Using a makes b the least recently used entry, which c evicts.
+	if dn, ok := d.get("a", now); !ok || dn != "uid=a" {
+		t.Fatalf("get(a) = %q, %v", dn, ok)
+	}
+
+	d.put("c", "uid=c", now)
+	if _, ok := d.get("b", now); ok {
+		t.Fatal("expected b to be evicted")
+	}
+
+	if d.len() != 2 {
+		t.Fatalf("len = %d, want 2", d.len())
+	}
+
+	// Entries expire after the TTL; storing again renews them.
+	d.put("a", "uid=a2", now.Add(30*time.Second))
+	if dn, ok := d.get("a", now.Add(80*time.Second)); !ok || dn != "uid=a2" {
+		t.Fatalf("renewed get(a) = %q, %v", dn, ok)
+	}
+
+	if _, ok := d.get("c", now.Add(time.Minute)); ok {
+		t.Fatal("expected c to be expired")
+	}
+
+	if d.len() != 1 {
+		t.Fatalf("len after expiry = %d, want 1", d.len())
+	}
+}
+
+func TestLookupDN_CacheHit(t *testing.T) {
+	c := &client{m: metrics.New(), dns: newDNCache(time.Minute, 10)}
+	c.dns.put("bob", "uid=bob,dc=org", time.Now())
+
+	// A hit does not touch the lookup pool, which this client does not have.
+	if dn, err := c.LookupDN("bob"); err != nil || dn != "uid=bob,dc=org" {
+		t.Fatalf("LookupDN = %q, %v", dn, err)
+	}
+
+	if _, ok := c.cachedDN("alice"); ok {
+		t.Fatal("unexpected hit for alice")
+	}
+
+	if hits, misses := c.m.DNCacheHits.Load(), c.m.DNCacheMisses.Load(); hits != 1 || misses != 1 {
+		t.Fatalf("hits=%d misses=%d, want 1/1", hits, misses)
+	}
+
+	if phases := c.m.PhaseNames(); len(phases) != 0 {
+		t.Fatalf("cache hit recorded phases %v", phases)
+	}
+
+	if n, err := (&client{}).PrewarmDNs([]string{"bob"}); n != 0 || err != nil {
+		t.Fatalf("PrewarmDNs without cache = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,189 @@
+package ldapclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrUserNotFound is returned by LookupDN when no entry matches the username.
+var ErrUserNotFound = errors.New("user not found")
+
+// Error classes that are not LDAP result codes.
+const (
+	ClassDial         = "dialError"       // TCP or Unix socket connect failed
+	ClassTLS          = "tlsError"        // TLS handshake or StartTLS failed
+	ClassTimeout      = "timeout"         // no response within the timeout
+	ClassReset        = "connectionReset" // connection reset or closed by the peer
+	ClassUserNotFound = "userNotFound"    // DN lookup returned no entry
+	ClassOther        = "other"
+)
+
+// resultClasses names LDAP result codes as in RFC 4511, plus the client-side
+// codes of go-ldap.
+var resultClasses = map[uint16]string{
+	ldap.LDAPResultOperationsError:                    "operationsError",
+	ldap.LDAPResultProtocolError:                      "protocolError",
+	ldap.LDAPResultTimeLimitExceeded:                  "timeLimitExceeded",
+	ldap.LDAPResultSizeLimitExceeded:                  "sizeLimitExceeded",
+	ldap.LDAPResultCompareFalse:                       "compareFalse",
+	ldap.LDAPResultCompareTrue:                        "compareTrue",
+	ldap.LDAPResultAuthMethodNotSupported:             "authMethodNotSupported",
+	ldap.LDAPResultStrongAuthRequired:                 "strongerAuthRequired",
+	ldap.LDAPResultReferral:                           "referral",
+	ldap.LDAPResultAdminLimitExceeded:                 "adminLimitExceeded",
+	ldap.LDAPResultUnavailableCriticalExtension:       "unavailableCriticalExtension",
+	ldap.LDAPResultConfidentialityRequired:            "confidentialityRequired",
+	ldap.LDAPResultSaslBindInProgress:                 "saslBindInProgress",
+	ldap.LDAPResultNoSuchAttribute:                    "noSuchAttribute",
+	ldap.LDAPResultUndefinedAttributeType:             "undefinedAttributeType",
+	ldap.LDAPResultInappropriateMatching:              "inappropriateMatching",
+	ldap.LDAPResultConstraintViolation:                "constraintViolation",
+	ldap.LDAPResultAttributeOrValueExists:             "attributeOrValueExists",
+	ldap.LDAPResultInvalidAttributeSyntax:             "invalidAttributeSyntax",
+	ldap.LDAPResultNoSuchObject:                       "noSuchObject",
+	ldap.LDAPResultAliasProblem:                       "aliasProblem",
+	ldap.LDAPResultInvalidDNSyntax:                    "invalidDNSyntax",
+	ldap.LDAPResultAliasDereferencingProblem:          "aliasDereferencingProblem",
+	ldap.LDAPResultInappropriateAuthentication:        "inappropriateAuthentication",
+	ldap.LDAPResultInvalidCredentials:                 "invalidCredentials",
+	ldap.LDAPResultInsufficientAccessRights:           "insufficientAccessRights",
+	ldap.LDAPResultBusy:                               "busy",
+	ldap.LDAPResultUnavailable:                        "unavailable",
+	ldap.LDAPResultUnwillingToPerform:                 "unwillingToPerform",
+	ldap.LDAPResultLoopDetect:                         "loopDetect",
+	ldap.LDAPResultNamingViolation:                    "namingViolation",
+	ldap.LDAPResultObjectClassViolation:               "objectClassViolation",
+	ldap.LDAPResultNotAllowedOnNonLeaf:                "notAllowedOnNonLeaf",
+	ldap.LDAPResultNotAllowedOnRDN:                    "notAllowedOnRDN",
+	ldap.LDAPResultEntryAlreadyExists:                 "entryAlreadyExists",
+	ldap.LDAPResultObjectClassModsProhibited:          "objectClassModsProhibited",
+	ldap.LDAPResultAffectsMultipleDSAs:                "affectsMultipleDSAs",
+	ldap.LDAPResultOther:                              "other",
+	ldap.ErrorNetwork:                                 "networkError",
+	ldap.ErrorFilterCompile:                           "filterCompileError",
+	ldap.ErrorFilterDecompile:                         "filterDecompileError",
+	ldap.ErrorUnexpectedMessage:                       "unexpectedMessage",
+	ldap.ErrorUnexpectedResponse:                      "unexpectedResponse",
+	ldap.ErrorEmptyPassword:                           "emptyPassword",
+	ldap.LDAPResultSortControlMissing:                 "sortControlMissing",
+	ldap.LDAPResultOffsetRangeError:                   "offsetRangeError",
+	ldap.LDAPResultVirtualListViewErrorOrControlError: "virtualListViewError",
+}
+
+// setupError marks failures while establishing a connection (dial, TLS) so
+// they can be told apart from failures of requests on an open connection.
+type setupError struct {
+	class string
+	err   error
+}
+
+func (e *setupError) Error() string { return e.err.Error() }
+
+func (e *setupError) Unwrap() error { return e.err }
+
+// IsPolicyError reports whether err is a password policy rejection, i.e. the
+// server refused a password change with constraintViolation (quality, history,
+// minimum age) or unwillingToPerform (changes not allowed for the user).
+func IsPolicyError(err error) bool {
+	return ldap.IsErrorAnyOf(err, ldap.LDAPResultConstraintViolation, ldap.LDAPResultUnwillingToPerform)
+}
+
+// ErrorClass returns the class of err: the RFC 4511 name of the LDAP result
+// code (e.g. "invalidCredentials", "busy") for errors returned by the server,
+// one of the Class constants for connection and lookup failures, and "other"
+// otherwise.
+func ErrorClass(err error) string {
+	var se *setupError
+	if errors.As(err, &se) {
+		return se.class
+	}
+
+	if errors.Is(err, ErrUserNotFound) {
+		return ClassUserNotFound
+	}
+
+	var lerr *ldap.Error
+	isLDAP := errors.As(err, &lerr)
+	if isLDAP && lerr.ResultCode != ldap.ErrorNetwork {
+		return resultClass(lerr.ResultCode)
+	}
+
+	switch {
+	case isTimeout(err):
+		return ClassTimeout
+	case isReset(err):
+		return ClassReset
+	case isTLS(err):
+		return ClassTLS
+	case isLDAP:
+		return resultClass(lerr.ResultCode)
+	}
+
+	return ClassOther
+}
+
+// ResultCode returns the LDAP result code carried by err, or 0 when err is
+// not an LDAP error.
+func ResultCode(err error) int {
+	var lerr *ldap.Error
+	if errors.As(err, &lerr) {
+		return int(lerr.ResultCode)
+	}
+
+	return 0
+}
+
+func resultClass(code uint16) string {
+	if name, ok := resultClasses[code]; ok {
+		return name
+	}
+
+	return "resultCode" + strconv.Itoa(int(code))
+}
+
+func isTimeout(err error) bool {
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) ||
+		strings.Contains(err.Error(), "timed out")
+}
+
+func isReset(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		return true
+	}
+
+	// go-ldap reports a dropped connection only by message.
+	msg := err.Error()
+
+	return strings.Contains(msg, "connection closed") || strings.Contains(msg, "response channel closed")
+}
+
+func isTLS(err error) bool {
+	var (
+		recErr    tls.RecordHeaderError
+		alertErr  tls.AlertError
+		verifyErr *tls.CertificateVerificationError
+		authErr   x509.UnknownAuthorityError
+		hostErr   x509.HostnameError
+		certErr   x509.CertificateInvalidError
+	)
+
+	return errors.As(err, &recErr) || errors.As(err, &alertErr) || errors.As(err, &verifyErr) ||
+		errors.As(err, &authErr) || errors.As(err, &hostErr) || errors.As(err, &certErr) ||
+		strings.Contains(err.Error(), "TLS handshake failed")
+}
@@ -1,15 +1,21 @@
 package ldapclient
 
 // Package ldapclient wraps basic LDAP operations used by the benchmark: a
-// lookup (service) connection for DN resolution as well as per-user bind and
-// search operations.
+// pool of lookup (service) connections for DN resolution, compare and write
+// operations as well as per-user bind and search operations.
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"strings"
+	"math/rand/v2"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/croessner/ldapbench/internal/config"
+	"github.com/croessner/ldapbench/internal/metrics"
 	"github.com/go-ldap/ldap/v3"
 )
 
@@ -18,99 +24,145 @@ type Client interface {
 	BindLookup() error
 	LookupDN(username string) (string, error)
 	UserBind(dn, password string) error
-	UserSearch(dn, password, filter string) (int, error) // returns entry count
+	UserSearch(dn, password, filter string) (int, error)         // returns entry count
+	Compare(dn, password, attribute, value string) (bool, error) // returns compareTrue
+	Modify(dn, password string, op config.ModifyOp, attribute string, values []string) error
+	Add(dn string, attrs map[string][]string) error
+	Delete(dn string) error
+	PasswordModify(dn, oldPassword, newPassword string) error
+	// PrewarmDNs fills the DN cache with the DNs of usernames before the
+	// measured phase and returns the number of cached DNs.
+	PrewarmDNs(usernames []string) (int, error)
+	// TLSState returns the negotiated TLS parameters of the lookup
+	// connection; ok is false for connections without TLS.
+	TLSState() (state tls.ConnectionState, ok bool)
 	Close()
 }
 
 type client struct {
-	cfg  *config.Config
-	conn *ldap.Conn // shared lookup connection
-	mu   sync.Mutex
-
-	// pool of persistent user connections reused across operations
-	pool chan *ldap.Conn
+	cfg *config.Config
+	m   *metrics.Metrics // optional; receives per-phase latencies
+
+	// lookups is the pool of lookup connections shared by all workers;
+	// bound is set once BindLookup succeeded, so reconnects bind again.
+	lookups chan *lookupConn
+	bound   atomic.Bool
+
+	// dns caches LookupDN results; nil when the DN cache is disabled.
+	dns *dnCache
+
+	// servers holds the configured LDAP servers, each with its pool of
+	// persistent user connections reused across operations.
+	servers []*server
+	next    atomic.Uint64 // round-robin position
+	rndMu   sync.Mutex
+	rnd     *rand.Rand // random server policy
 }
 
-// New creates a new client and establishes the lookup connection.
-func New(cfg *config.Config) (Client, error) {
-	c := &client{cfg: cfg}
+// New creates a new client without dialing: lookup connections are
+// established by BindLookup or on first use, so a run that needs no lookup
+// never opens one. When m is not nil, the client records dial, TLS handshake,
+// lookup, bind and search phases and the requests per server into it.
+func New(cfg *config.Config, m *metrics.Metrics) (Client, error) {
+	c := &client{cfg: cfg, m: m, rnd: rand.New(rand.NewPCG(cfg.Seed, 1))}
+
+	// Initialize the user connection pools (lazy). We only create the
+	// buffered channels with the target capacity (workers * connections) but
+	// do not pre-dial all connections at startup to avoid connection storms
+	// and server-side limits causing immediate EOFs. Connections are
+	// established on demand by workers.
+	size := cfg.MaxConcurrency() * cfg.Connections
+	if size < 1 {
+		size = 1
+	}
+
+	for _, raw := range cfg.LDAPURLs {
+		s, err := newServer(raw, size)
+		if err != nil {
+			return nil, err
+		}
 
-	if err := c.connectLookup(); err != nil {
-		return nil, err
+		c.servers = append(c.servers, s)
 	}
 
-	// Initialize user connection pool (lazy). We only create the buffered
-	// channel with the target capacity (concurrency * connections) but do not
-	// pre-dial all connections at startup to avoid connection storms and
-	// server-side limits causing immediate EOFs. Connections are established on
-	// demand by workers.
-	size := cfg.Concurrency * cfg.Connections
-	if size < 1 {
-		size = 1
+	if len(c.servers) == 0 {
+		return nil, errors.New("no ldap server configured")
+	}
+
+	if cfg.DNCacheTTL > 0 {
+		c.dns = newDNCache(cfg.DNCacheTTL, cfg.DNCacheSize)
 	}
 
-	c.pool = make(chan *ldap.Conn, size)
+	c.newLookupPool(max(cfg.LookupConnections, 1))
 
 	return c, nil
 }
 
-// connectLookup dials the server for the service/lookup account.
-func (c *client) connectLookup() error {
-	var l *ldap.Conn
-	var err error
+// BindLookup authenticates every connection of the lookup pool used for DN
+// resolution, compare and write operations, dialing those not yet open.
+// Connections re-dialed later are bound again automatically.
+func (c *client) BindLookup() error {
+	taken := make([]*lookupConn, 0, cap(c.lookups))
+	defer func() {
+		for _, lc := range taken {
+			c.lookups <- lc
+		}
+	}()
 
-	// Dial according to URL scheme. ldap library supports ldap://, ldaps://, and ldapi://.
-	// We only apply StartTLS on plain ldap://; ldaps:// uses TLS from the start and
-	// ldapi:// (Unix domain socket) does not support StartTLS.
-	if strings.HasPrefix(c.cfg.LDAPURL, "ldaps://") {
-		l, err = ldap.DialURL(c.cfg.LDAPURL, ldap.DialWithTLSConfig(c.cfg.TLSConfig()))
-	} else {
-		l, err = ldap.DialURL(c.cfg.LDAPURL)
-		if err == nil && c.cfg.StartTLS && strings.HasPrefix(c.cfg.LDAPURL, "ldap://") {
-			if err2 := l.StartTLS(c.cfg.TLSConfig()); err2 != nil {
-				l.Close()
-				err = err2
-			}
+	for range cap(c.lookups) {
+		lc := <-c.lookups
+		taken = append(taken, lc)
+
+		if err := c.ready(lc); err != nil {
+			return err
 		}
-	}
 
-	if err != nil {
-		return err
+		if err := c.bindLookup(lc.l); err != nil {
+			return err
+		}
 	}
 
-	// Apply a reasonable timeout for lookup operations
-	l.SetTimeout(c.cfg.Timeout)
-	c.mu.Lock()
-	c.conn = l
-	c.mu.Unlock()
+	c.bound.Store(true)
 
 	return nil
 }
 
-// BindLookup authenticates the shared lookup connection used for DN resolution.
-//
-// When cfg.SaslExternal is true, we authenticate using SASL/EXTERNAL so that
-// DN resolution (LookupDN) runs under the socket/certificate identity. This is
-// typical for ldapi:// or mutual TLS setups. Otherwise we use a simple bind
-// with the configured lookup DN and password.
-func (c *client) BindLookup() error {
-	c.mu.Lock()
-	l := c.conn
-	c.mu.Unlock()
+// LookupDN finds a user's DN using the configured UID attribute. With the DN
+// cache enabled, a cached DN is returned without a search and a found one is
+// cached.
+func (c *client) LookupDN(username string) (string, error) {
+	if c.dns != nil {
+		if dn, ok := c.cachedDN(username); ok {
+			return dn, nil
+		}
+	}
 
-	if c.cfg.SaslExternal {
-		return l.ExternalBind()
+	var dn string
+	err := c.lookup(func(l *ldap.Conn) error {
+		var err error
+		dn, err = c.lookupDN(l, username)
+
+		return err
+	})
+
+	if err == nil && c.dns != nil {
+		c.dns.put(username, dn, time.Now())
 	}
 
-	return l.Bind(c.cfg.LookupBindDN, c.cfg.LookupBindPass)
+	return dn, err
 }
 
-// LookupDN finds a user's DN using the configured UID attribute.
-func (c *client) LookupDN(username string) (string, error) {
-	c.mu.Lock()
-	l := c.conn
-	c.mu.Unlock()
+// lookupDN searches the DN of username on l and records the lookup phase.
+func (c *client) lookupDN(l *ldap.Conn, username string) (string, error) {
+	start := time.Now()
+	dn, err := c.searchDN(l, username)
+	c.observe(metrics.PhaseLookup, start, err)
 
+	return dn, err
+}
+
+// searchDN searches the DN of username on l.
+func (c *client) searchDN(l *ldap.Conn, username string) (string, error) {
 	filter := fmt.Sprintf("(&(%s=%s)(objectClass=person))", c.cfg.UIDAttr, ldap.EscapeFilter(username))
 	req := ldap.NewSearchRequest(
 		c.cfg.BaseDN,
@@ -126,67 +178,110 @@ func (c *client) LookupDN(username string) (string, error) {
 	}
 
 	if len(res.Entries) == 0 {
-		return "", fmt.Errorf("user not found")
+		return "", ErrUserNotFound
 	}
 
 	return res.Entries[0].DN, nil
 }
 
-// dialUser creates a new connection for a user operation (bind/search).
-func (c *client) dialUser() (*ldap.Conn, error) {
-	// Same scheme handling as connectLookup.
-	if strings.HasPrefix(c.cfg.LDAPURL, "ldaps://") {
-		// Use shared TLS config to honor InsecureSkipVerify and optional client certs
-		l, err := ldap.DialURL(c.cfg.LDAPURL, ldap.DialWithTLSConfig(c.cfg.TLSConfig()))
-		if err != nil {
-			return nil, err
+// Compare binds as the user on a pooled connection and issues an LDAP Compare
+// for dn, so the user's access rights apply. A compareFalse result is not an
+// error; it is reported as false.
+func (c *client) Compare(dn, password, attribute, value string) (bool, error) {
+	var ok bool
+	err := c.withConn(func(l *ldap.Conn) error {
+		if err := c.bind(l, dn, password); err != nil {
+			return err
 		}
 
-		l.SetTimeout(c.cfg.Timeout)
+		var err error
+		ok, err = l.Compare(dn, attribute, value)
+
+		return err
+	})
+
+	return ok, err
+}
 
-		return l, nil
+// Modify binds as the user on a pooled connection and applies a single change
+// of the given type to dn. For ModifyDelete an empty values slice removes the
+// attribute.
+func (c *client) Modify(dn, password string, op config.ModifyOp, attribute string, values []string) error {
+	req := ldap.NewModifyRequest(dn, nil)
+	switch op {
+	case config.ModifyAdd:
+		req.Add(attribute, values)
+	case config.ModifyDelete:
+		req.Delete(attribute, values)
+	default:
+		req.Replace(attribute, values)
 	}
 
-	l, err := ldap.DialURL(c.cfg.LDAPURL)
-	if err != nil {
-		return nil, err
+	return c.withConn(func(l *ldap.Conn) error {
+		if err := c.bind(l, dn, password); err != nil {
+			return err
+		}
+
+		return l.Modify(req)
+	})
+}
+
+// Add creates a new entry on the lookup connection. Attribute types are sent in
+// sorted order so requests are stable across runs.
+func (c *client) Add(dn string, attrs map[string][]string) error {
+	types := make([]string, 0, len(attrs))
+	for typ := range attrs {
+		types = append(types, typ)
 	}
 
-	if c.cfg.StartTLS && strings.HasPrefix(c.cfg.LDAPURL, "ldap://") {
-		if err := l.StartTLS(c.cfg.TLSConfig()); err != nil {
-			l.Close()
+	sort.Strings(types)
 
-			return nil, err
-		}
+	req := ldap.NewAddRequest(dn, nil)
+	for _, typ := range types {
+		req.Attribute(typ, attrs[typ])
 	}
 
-	l.SetTimeout(c.cfg.Timeout)
+	return c.lookup(func(l *ldap.Conn) error { return l.Add(req) })
+}
 
-	return l, nil
+// Delete removes the entry dn on the lookup connection.
+func (c *client) Delete(dn string) error {
+	return c.lookup(func(l *ldap.Conn) error { return l.Del(ldap.NewDelRequest(dn, nil)) })
 }
 
-// UserBind performs a bind using the provided DN and password on a fresh
-// connection to avoid cross-talk and to simulate real-world auth traffic.
-func (c *client) UserBind(dn, password string) error {
-	l := c.getConn()
-	if l == nil {
-		return fmt.Errorf("no connection available")
+// TLSState returns the TLS connection state of a lookup connection.
+func (c *client) TLSState() (tls.ConnectionState, bool) {
+	lc := <-c.lookups
+	defer func() { c.lookups <- lc }()
+
+	if c.ready(lc) != nil {
+		return tls.ConnectionState{}, false
 	}
 
-	// Rebind on the persistent connection; do not unbind/close.
-	err := l.Bind(dn, password)
-	c.putConn(l, err)
+	return lc.l.TLSConnectionState()
+}
 
-	return err
+// UserBind performs a bind using the provided DN and password on a pooled
+// connection to simulate real-world auth traffic.
+func (c *client) UserBind(dn, password string) error {
+	// Rebind on the persistent connection; do not unbind/close.
+	return c.withConn(func(l *ldap.Conn) error { return c.bind(l, dn, password) })
 }
 
 // UserSearch binds as the user and executes a search; returns number of entries.
 func (c *client) UserSearch(dn, password, filter string) (int, error) {
-	l := c.getConn()
-	if l == nil {
-		return 0, fmt.Errorf("no connection available")
-	}
+	var n int
+	err := c.withConn(func(l *ldap.Conn) error {
+		var err error
+		n, err = c.userSearch(l, dn, password, filter)
+
+		return err
+	})
+
+	return n, err
+}
 
+func (c *client) userSearch(l *ldap.Conn, dn, password, filter string) (int, error) {
 	// Authenticate for the search phase.
 	// If SASL/EXTERNAL is enabled, use it; otherwise fall back to simple bind.
 	var authErr error
@@ -194,14 +289,14 @@ func (c *client) UserSearch(dn, password, filter string) (int, error) {
 		// SASL/EXTERNAL requires either ldapi:// or TLS client certificates
 		// (mutual TLS). The underlying library performs the proper bind based
 		// on the active transport.
+		start := time.Now()
 		authErr = l.ExternalBind()
+		c.observe(metrics.PhaseBind, start, authErr)
 	} else {
-		authErr = l.Bind(dn, password)
+		authErr = c.bind(l, dn, password)
 	}
 
 	if authErr != nil {
-		c.putConn(l, authErr)
-
 		return 0, authErr
 	}
 
@@ -211,8 +306,9 @@ func (c *client) UserSearch(dn, password, filter string) (int, error) {
 		filter, []string{"dn"}, nil,
 	)
 
+	start := time.Now()
 	res, err := l.Search(req)
-	c.putConn(l, err)
+	c.observe(metrics.PhaseSearch, start, err)
 	if err != nil {
 		return 0, err
 	}
@@ -220,65 +316,197 @@ func (c *client) UserSearch(dn, password, filter string) (int, error) {
 	return len(res.Entries), nil
 }
 
-// Close closes the lookup connection.
-func (c *client) Close() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// PasswordModify binds as the user and changes the password with the RFC 3062
+// Password Modify extended operation, acting on the bound identity like a
+// user-initiated password change.
+func (c *client) PasswordModify(dn, oldPassword, newPassword string) error {
+	return c.withConn(func(l *ldap.Conn) error {
+		if err := c.bind(l, dn, oldPassword); err != nil {
+			return err
+		}
+
+		_, err := l.PasswordModify(ldap.NewPasswordModifyRequest("", oldPassword, newPassword))
 
-	if c.conn != nil {
-		c.conn.Close()
-		c.conn = nil
+		return err
+	})
+}
+
+// bind performs a simple bind on l and records the bind phase.
+func (c *client) bind(l *ldap.Conn, dn, password string) error {
+	start := time.Now()
+	err := l.Bind(dn, password)
+	c.observe(metrics.PhaseBind, start, err)
+
+	return err
+}
+
+// observe records the duration of a phase started at start when metrics are
+// attached to the client, into the warm-up bucket during the warm-up phase.
+func (c *client) observe(phase string, start time.Time, err error) {
+	if c.m == nil {
+		return
 	}
 
-	if c.pool != nil {
-		close(c.pool)
-		for l := range c.pool {
-			if l != nil {
-				l.Close()
-			}
+	c.m.Bucket().Phase(phase).Record(time.Since(start), err)
+}
+
+// Close closes the lookup and user connections.
+func (c *client) Close() {
+	c.closeLookups()
+
+	for _, s := range c.servers {
+		close(s.pool)
+		for uc := range s.pool {
+			c.poolIdle(-1)
+			c.closeConn(uc.l)
 		}
 	}
 }
 
-// getConn borrows a user connection from the pool.
-func (c *client) getConn() *ldap.Conn {
+// closeConn closes l and updates the open connections gauge.
+func (c *client) closeConn(l *ldap.Conn) {
+	l.Close()
+	if c.m != nil {
+		c.m.OpenConns.Add(-1)
+	}
+}
+
+// poolIdle adjusts the idle pool connections gauge by delta.
+func (c *client) poolIdle(delta int64) {
+	if c.m != nil {
+		c.m.PoolIdle.Add(delta)
+	}
+}
+
+// userConn is a user connection with the state its lifecycle policy
+// (--conn-policy, --conn-max-age, --conn-max-uses) depends on.
+type userConn struct {
+	l       *ldap.Conn
+	created time.Time
+	uses    int // operations served
+}
+
+// withConn runs fn on a user connection and hands the connection back,
+// recording the request into the metrics of the connection's server.
+func (c *client) withConn(fn func(l *ldap.Conn) error) error {
+	start := time.Now()
+
+	uc, s, err := c.getConn()
+	if err != nil {
+		return err
+	}
+
+	s.inFlight.Add(1)
+	err = fn(uc.l)
+	s.inFlight.Add(-1)
+	uc.uses++
+	c.record(s, start, err)
+	c.putConn(uc, s, err)
+
+	return err
+}
+
+// getConn borrows a user connection from the pool of the server chosen by
+// the server policy or dials a new one, failing over to the other servers.
+func (c *client) getConn() (*userConn, *server, error) {
+	servers := c.candidates()
+
 	// Try to reuse an existing connection if available without blocking.
-	select {
-	case l := <-c.pool:
-		return l
-	default:
+	// Connections that reached --conn-max-age while idle are retired.
+	s := servers[0]
+	for {
+		var uc *userConn
+		select {
+		case uc = <-s.pool:
+		default:
+		}
+
+		if uc == nil {
+			break
+		}
+
+		c.poolIdle(-1)
+		if !c.expired(uc) {
+			return uc, s, nil
+		}
+
+		c.retire(uc)
 	}
 
-	// Otherwise dial a new one on demand. If dialing fails, return nil so the
-	// caller can count a failure without blocking.
-	l, err := c.dialUser()
+	// Otherwise dial a new one on demand. A dial error is returned to the
+	// caller, which counts a failure without blocking.
+	l, s, err := c.connect(servers)
 	if err != nil {
-		return nil
+		return nil, nil, err
 	}
 
-	return l
+	return &userConn{l: l, created: time.Now()}, s, nil
 }
 
-// putConn returns the connection to the pool. If err suggests the connection is
-// broken, the connection is closed and replaced with a fresh one.
-func (c *client) putConn(l *ldap.Conn, err error) {
-	if l == nil {
+// putConn returns the connection to the pool of s. If err suggests the
+// connection is broken, the connection is closed and replaced with a fresh
+// one; if the server is unreachable, it is skipped for a while. A connection
+// the connection policy does not allow to be used again is retired.
+func (c *client) putConn(uc *userConn, s *server, err error) {
+	if uc == nil {
 		return
 	}
 
-	if err != nil {
+	// A connection per operation ends with an unbind like after a success
+	// as long as the server is still reachable.
+	l := uc.l
+	if err != nil && (c.cfg.ConnPolicy != config.ConnPerOperation || serverDown(err)) {
 		// On error, consider the connection tainted: close it and do not
 		// return it to the pool. We do not immediately redial here to keep
 		// pressure off the server; subsequent getConn will dial on demand.
-		l.Close()
+		c.closeConn(l)
+
+		if serverDown(err) {
+			c.markDown(s)
+		}
+
+		return
+	}
+
+	if c.expired(uc) {
+		c.retire(uc)
 
 		return
 	}
 
 	// Return to pool if there is space; otherwise close to avoid leaking file descriptors.
 	select {
-	case c.pool <- l:
+	case s.pool <- uc:
+		c.poolIdle(1)
+	default:
+		c.closeConn(l)
+	}
+}
+
+// expired reports whether the connection policy retires uc instead of using
+// it for another operation.
+func (c *client) expired(uc *userConn) bool {
+	switch {
+	case c.cfg.ConnPolicy == config.ConnPerOperation:
+		return uc.uses > 0
+	case c.cfg.ConnMaxUses > 0 && uc.uses >= c.cfg.ConnMaxUses:
+		return true
+	case c.cfg.ConnMaxAge > 0 && time.Since(uc.created) >= c.cfg.ConnMaxAge:
+		return true
 	default:
-		l.Close()
+		return false
+	}
+}
+
+// retire ends uc the way a well-behaved client does, with an unbind, and
+// closes it. The unbind is recorded as a phase of its own.
+func (c *client) retire(uc *userConn) {
+	start := time.Now()
+	err := uc.l.Unbind()
+	c.observe(metrics.PhaseUnbind, start, err)
+	c.closeConn(uc.l)
+
+	if c.m != nil {
+		c.m.Bucket().Retired.Add(1)
 	}
 }
@@ -1,4 +1,208 @@
 package ldapclient
 
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/croessner/ldapbench/internal/config"
+	"github.com/croessner/ldapbench/internal/metrics"
+	"github.com/go-ldap/ldap/v3"
+)
+
 // Compile-time assertion that *client implements Client.
 var _ Client = (*client)(nil)
+
+func TestEndpoint(t *testing.T) {
+	tests := []struct {
+		url     string
+		network string
+		addr    string
+		wantErr bool
+	}{
+		{url: "ldap://example.org", network: "tcp", addr: "example.org:389"},
+		{url: "ldaps://example.org", network: "tcp", addr: "example.org:636"},
+		{url: "ldap://example.org:1389", network: "tcp", addr: "example.org:1389"},
+		{url: "ldapi:///run/slapd/ldapi", network: "unix", addr: "/run/slapd/ldapi"},
+		{url: "ldapi://", network: "unix", addr: "/var/run/slapd/ldapi"},
+		{url: "http://example.org", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tt.url, err)
+		}
+
+		network, addr, _, err := endpoint(u)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("endpoint(%s) err=%v, wantErr=%v", tt.url, err, tt.wantErr)
+		}
+
+		if !tt.wantErr && (network != tt.network || addr != tt.addr) {
+			t.Fatalf("endpoint(%s) = %s %s, want %s %s", tt.url, network, addr, tt.network, tt.addr)
+		}
+	}
+}
+
+func TestDialRecordsPhase(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			defer conn.Close()
+		}
+	}()
+
+	m := metrics.New()
+	c := &client{cfg: &config.Config{Timeout: time.Second}, m: m}
+
+	s, err := newServer("ldap://"+ln.Addr().String(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := c.dial(s)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+
+	l.Close()
+
+	if got := m.Phase(metrics.PhaseDial).Success.Load(); got != 1 {
+		t.Fatalf("expected one successful dial phase, got %d", got)
+	}
+
+	if names := m.PhaseNames(); len(names) != 1 {
+		t.Fatalf("unexpected phases recorded: %v", names)
+	}
+}
+
+func TestNew_DialsLazily(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	// Nothing listens at url anymore, so every dial fails.
+	url := "ldap://" + ln.Addr().String()
+	ln.Close()
+
+	m := metrics.New()
+	c, err := New(&config.Config{LDAPURLs: []string{url}, Timeout: time.Second, ServerRetry: time.Minute, LookupConnections: 2}, m)
+	if err != nil {
+		t.Fatalf("New dialed: %v", err)
+	}
+	defer c.Close()
+
+	if names := m.PhaseNames(); len(names) != 0 {
+		t.Fatalf("New recorded phases %v", names)
+	}
+
+	if err := c.BindLookup(); ErrorClass(err) != ClassDial {
+		t.Fatalf("expected BindLookup to dial and fail, got %v", err)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+		code int
+	}{
+		{"invalid credentials", ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("bad")), "invalidCredentials", 49},
+		{"busy", ldap.NewError(ldap.LDAPResultBusy, errors.New("busy")), "busy", 51},
+		{"unknown code", ldap.NewError(4242, errors.New("x")), "resultCode4242", 4242},
+		{"dial", ldap.NewError(ldap.ErrorNetwork, &setupError{class: ClassDial, err: syscall.ECONNREFUSED}), ClassDial, 200},
+		{"tls", ldap.NewError(ldap.ErrorNetwork, &setupError{class: ClassTLS, err: errors.New("handshake")}), ClassTLS, 200},
+		{"timeout", ldap.NewError(ldap.ErrorNetwork, errors.New("ldap: connection timed out")), ClassTimeout, 200},
+		{"reset", ldap.NewError(ldap.ErrorNetwork, fmt.Errorf("read: %w", syscall.ECONNRESET)), ClassReset, 200},
+		{"closed", ldap.NewError(ldap.ErrorNetwork, errors.New("ldap: connection closed")), ClassReset, 200},
+		{"network", ldap.NewError(ldap.ErrorNetwork, errors.New("boom")), "networkError", 200},
+		{"user not found", ErrUserNotFound, ClassUserNotFound, 0},
+		{"plain", errors.New("boom"), ClassOther, 0},
+	}
+
+	for _, tt := range tests {
+		if got := ErrorClass(tt.err); got != tt.want {
+			t.Errorf("%s: ErrorClass = %q, want %q", tt.name, got, tt.want)
+		}
+
+		if got := ResultCode(tt.err); got != tt.code {
+			t.Errorf("%s: ResultCode = %d, want %d", tt.name, got, tt.code)
+		}
+	}
+}
+
+func TestConnPolicy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			defer conn.Close()
+		}
+	}()
+
+	tests := []struct {
+		name        string
+		policy      config.ConnPolicy
+		maxAge      time.Duration
+		maxUses     int
+		wantDials   int64
+		wantRetired int64
+	}{
+		{name: "reuse", policy: config.ConnReuse, wantDials: 1},
+		{name: "per operation", policy: config.ConnPerOperation, wantDials: 3, wantRetired: 3},
+		{name: "max uses", policy: config.ConnReuse, maxUses: 2, wantDials: 2, wantRetired: 1},
+		{name: "max age", policy: config.ConnReuse, maxAge: time.Nanosecond, wantDials: 3, wantRetired: 3},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testServers(t, config.ServerRoundRobin, "ldap://"+ln.Addr().String())
+			c.cfg.ConnPolicy, c.cfg.ConnMaxAge, c.cfg.ConnMaxUses = tc.policy, tc.maxAge, tc.maxUses
+			defer c.Close()
+
+			for range 3 {
+				if err := c.withConn(func(*ldap.Conn) error { return nil }); err != nil {
+					t.Fatalf("withConn: %v", err)
+				}
+			}
+
+			if got := c.m.Phase(metrics.PhaseDial).Attempts.Load(); got != tc.wantDials {
+				t.Fatalf("dials = %d, want %d", got, tc.wantDials)
+			}
+
+			if got := c.m.Retired.Load(); got != tc.wantRetired {
+				t.Fatalf("retired = %d, want %d", got, tc.wantRetired)
+			}
+
+			if got := c.m.Phase(metrics.PhaseUnbind).Attempts.Load(); got != tc.wantRetired {
+				t.Fatalf("unbinds = %d, want %d", got, tc.wantRetired)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package ldapclient
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// lookupConn is one connection of the lookup pool. It belongs to whoever took
+// it from the pool, so its fields need no locking.
+type lookupConn struct {
+	l        *ldap.Conn
+	s        *server   // server of l
+	used     bool      // l was established before; dialing again is a reconnect
+	failures int       // consecutive failed attempts to (re)connect
+	retryAt  time.Time // no new attempt before then
+	err      error     // error of the last failed attempt
+}
+
+// newLookupPool creates n lookup connections without dialing them.
+func (c *client) newLookupPool(n int) {
+	c.lookups = make(chan *lookupConn, n)
+	for range n {
+		c.lookups <- &lookupConn{}
+	}
+}
+
+// ready makes sure lc holds an open lookup connection, bound once BindLookup
+// succeeded. A closed or broken connection is re-dialed and re-bound; after a
+// failed attempt the next one waits for the backoff, and until then ready
+// fails right away with the last error instead of dialing.
+func (c *client) ready(lc *lookupConn) error {
+	if lc.l != nil {
+		if !lc.l.IsClosing() {
+			return nil
+		}
+
+		c.closeConn(lc.l)
+		lc.l = nil
+	}
+
+	if wait := time.Until(lc.retryAt); wait > 0 {
+		return fmt.Errorf("lookup connection down, reconnect in %s: %w", wait.Round(time.Millisecond), lc.err)
+	}
+
+	l, s, err := c.connect(c.candidates())
+	if err == nil && c.bound.Load() {
+		if err = c.bindLookup(l); err != nil {
+			c.closeConn(l)
+		}
+	}
+
+	reconnect := lc.used
+	if err != nil {
+		lc.failures++
+		lc.retryAt = time.Now().Add(c.backoff(lc.failures))
+		lc.err = err
+
+		if reconnect && c.m != nil {
+			c.m.Bucket().ReconnectFailures.Add(1)
+		}
+
+		return err
+	}
+
+	lc.l, lc.s, lc.used = l, s, true
+	lc.failures, lc.retryAt, lc.err = 0, time.Time{}, nil
+
+	if reconnect && c.m != nil {
+		c.m.Bucket().Reconnects.Add(1)
+	}
+
+	return nil
+}
+
+// backoff returns the delay after the given number of consecutive failed
+// attempts: ReconnectBackoff doubled per further failure, capped at
+// ReconnectMaxBackoff.
+func (c *client) backoff(failures int) time.Duration {
+	d := c.cfg.ReconnectBackoff
+	for i := 1; i < failures && d < c.cfg.ReconnectMaxBackoff; i++ {
+		d *= 2
+	}
+
+	return min(d, c.cfg.ReconnectMaxBackoff)
+}
+
+// bindLookup authenticates l as the lookup account.
+//
+// When cfg.SaslExternal is true, we authenticate using SASL/EXTERNAL so that
+// DN resolution (LookupDN) runs under the socket/certificate identity. This is
+// typical for ldapi:// or mutual TLS setups. Otherwise we use a simple bind
+// with the configured lookup DN and password.
+func (c *client) bindLookup(l *ldap.Conn) error {
+	if c.cfg.SaslExternal {
+		return l.ExternalBind()
+	}
+
+	return l.Bind(c.cfg.LookupBindDN, c.cfg.LookupBindPass)
+}
+
+// lookup runs fn on a connection of the lookup pool and records it as a
+// request to the connection's server. A connection that fn left closed or
+// broken is dropped and re-dialed by the next request that takes it.
+func (c *client) lookup(fn func(l *ldap.Conn) error) error { return c.useLookup(true, fn) }
+
+// useLookup is lookup; record false leaves the server metrics untouched.
+func (c *client) useLookup(record bool, fn func(l *ldap.Conn) error) error {
+	lc := <-c.lookups
+	defer func() { c.lookups <- lc }()
+
+	if err := c.ready(lc); err != nil {
+		return err
+	}
+
+	s := lc.s
+	start := time.Now()
+	s.inFlight.Add(1)
+	err := fn(lc.l)
+	s.inFlight.Add(-1)
+
+	if record {
+		c.record(s, start, err)
+	}
+
+	if err != nil && (serverDown(err) || lc.l.IsClosing()) {
+		c.closeConn(lc.l)
+		lc.l = nil
+
+		if serverDown(err) {
+			c.markDown(s)
+		}
+	}
+
+	return err
+}
+
+// closeLookups closes the connections of the lookup pool. Call it when no
+// request uses the pool anymore.
+func (c *client) closeLookups() {
+	for range cap(c.lookups) {
+		if lc := <-c.lookups; lc.l != nil {
+			c.closeConn(lc.l)
+			lc.l = nil
+		}
+	}
+}
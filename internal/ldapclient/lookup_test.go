@@ -0,0 +1,117 @@
+package ldapclient
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/croessner/ldapbench/internal/config"
+	"github.com/go-ldap/ldap/v3"
+)
+
+func TestBackoff(t *testing.T) {
+	c := &client{cfg: &config.Config{ReconnectBackoff: 100 * time.Millisecond, ReconnectMaxBackoff: time.Second}}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{64, time.Second},
+	}
+
+	for _, tc := range tests {
+		if got := c.backoff(tc.failures); got != tc.want {
+			t.Fatalf("backoff(%d) = %s, want %s", tc.failures, got, tc.want)
+		}
+	}
+}
+
+// waitBroken waits until the server side close of the pooled lookup
+// connection has been noticed.
+func waitBroken(t *testing.T, c *client) {
+	t.Helper()
+
+	lc := <-c.lookups
+	defer func() { c.lookups <- lc }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !lc.l.IsClosing() {
+		if time.Now().After(deadline) {
+			t.Fatal("lookup connection not detected as closed")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLookup_Reconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	conns := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			conns <- conn
+		}
+	}()
+
+	url := "ldap://" + ln.Addr().String()
+	c := testServers(t, config.ServerRoundRobin, url)
+	c.cfg.ReconnectBackoff, c.cfg.ReconnectMaxBackoff = time.Minute, time.Minute
+	c.newLookupPool(1)
+	defer c.closeLookups()
+
+	noop := func(*ldap.Conn) error { return nil }
+
+	if err := c.lookup(noop); err != nil {
+		t.Fatalf("first lookup: %v", err)
+	}
+
+	// The server drops the connection; the next request re-dials.
+	(<-conns).Close()
+	waitBroken(t, c)
+
+	if err := c.lookup(noop); err != nil {
+		t.Fatalf("lookup after server close: %v", err)
+	}
+
+	if got := c.m.Reconnects.Load(); got != 1 {
+		t.Fatalf("reconnects = %d, want 1", got)
+	}
+
+	// With the server gone the reconnect fails and the next request fails
+	// fast during the backoff instead of dialing again.
+	ln.Close()
+	(<-conns).Close()
+	waitBroken(t, c)
+
+	if err := c.lookup(noop); err == nil {
+		t.Fatal("expected reconnect to fail")
+	}
+
+	requests := c.m.Server(url).Attempts.Load()
+	if err := c.lookup(noop); err == nil || !strings.Contains(err.Error(), "reconnect in") || ErrorClass(err) != ClassDial {
+		t.Fatalf("expected backoff error of class %s, got %v (%s)", ClassDial, err, ErrorClass(err))
+	}
+
+	if got := c.m.Server(url).Attempts.Load(); got != requests {
+		t.Fatalf("dialed during backoff: %d requests, want %d", got, requests)
+	}
+
+	if got := c.m.ReconnectFailures.Load(); got != 1 {
+		t.Fatalf("reconnect failures = %d, want 1", got)
+	}
+}
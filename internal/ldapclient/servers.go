@@ -0,0 +1,126 @@
+package ldapclient
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/croessner/ldapbench/internal/config"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// server is one LDAP server of the configured set together with its idle
+// user connections.
+type server struct {
+	url       string
+	u         *url.URL
+	pool      chan *userConn
+	inFlight  atomic.Int64
+	downUntil atomic.Int64 // UnixNano; the server is skipped until then
+}
+
+// newServer parses rawURL and creates a server whose pool keeps up to
+// poolSize idle connections.
+func newServer(rawURL string, poolSize int) (*server, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse ldap url %q: %w", rawURL, err)
+	}
+
+	return &server{url: rawURL, u: u, pool: make(chan *userConn, poolSize)}, nil
+}
+
+// down reports whether the server is skipped at now (UnixNano).
+func (s *server) down(now int64) bool { return s.downUntil.Load() > now }
+
+// markDown skips s for the configured retry interval.
+func (c *client) markDown(s *server) {
+	s.downUntil.Store(time.Now().Add(c.cfg.ServerRetry).UnixNano())
+}
+
+// candidates returns the servers in the order a new connection tries them:
+// the one chosen by the server policy first, then the others. Servers marked
+// down go last, so they are only tried when every other server failed.
+func (c *client) candidates() []*server {
+	n := len(c.servers)
+	if n == 1 {
+		return c.servers
+	}
+
+	var start int
+	if c.cfg.ServerPolicy == config.ServerRandom {
+		c.rndMu.Lock()
+		start = c.rnd.IntN(n)
+		c.rndMu.Unlock()
+	} else {
+		// Rotating the start also spreads ties of least-inflight.
+		start = int((c.next.Add(1) - 1) % uint64(n))
+	}
+
+	out := make([]*server, 0, n)
+	for i := range n {
+		out = append(out, c.servers[(start+i)%n])
+	}
+
+	if c.cfg.ServerPolicy == config.ServerLeastInFlight {
+		sort.SliceStable(out, func(i, j int) bool { return out[i].inFlight.Load() < out[j].inFlight.Load() })
+	}
+
+	now := time.Now().UnixNano()
+	sort.SliceStable(out, func(i, j int) bool { return !out[i].down(now) && out[j].down(now) })
+
+	return out
+}
+
+// connect dials a connection to the first of servers (in the order of
+// candidates) that accepts it. A server that fails is marked down and the
+// next one is tried (failover); once a server marked down failed as well, the
+// remaining ones are not tried either.
+func (c *client) connect(servers []*server) (*ldap.Conn, *server, error) {
+	var err error
+
+	now := time.Now().UnixNano()
+	for _, s := range servers {
+		if err != nil && s.down(now) {
+			break
+		}
+
+		if err != nil && c.m != nil {
+			c.m.Bucket().Failovers.Add(1)
+		}
+
+		start := time.Now()
+
+		var l *ldap.Conn
+		if l, err = c.dial(s); err == nil {
+			return l, s, nil
+		}
+
+		c.record(s, start, err)
+		c.markDown(s)
+	}
+
+	return nil, nil, err
+}
+
+// record adds a request to s started at start to the server's metrics.
+func (c *client) record(s *server, start time.Time, err error) {
+	if c.m == nil {
+		return
+	}
+
+	c.m.Bucket().Server(s.url).Record(time.Since(start), err)
+}
+
+// serverDown reports whether err shows that the server is unreachable rather
+// than that it rejected a request.
+func serverDown(err error) bool {
+	switch ErrorClass(err) {
+	case ClassDial, ClassReset:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,127 @@
+package ldapclient
+
+import (
+	"math/rand/v2"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/croessner/ldapbench/internal/config"
+	"github.com/croessner/ldapbench/internal/metrics"
+)
+
+func testServers(t *testing.T, policy config.ServerPolicy, urls ...string) *client {
+	t.Helper()
+
+	c := &client{cfg: &config.Config{ServerPolicy: policy, ServerRetry: time.Minute, Timeout: time.Second}, m: metrics.New(), rnd: rand.New(rand.NewPCG(1, 1))}
+	for _, u := range urls {
+		s, err := newServer(u, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.servers = append(c.servers, s)
+	}
+
+	return c
+}
+
+func firsts(c *client, n int) map[string]int {
+	out := make(map[string]int)
+	for range n {
+		out[c.candidates()[0].url]++
+	}
+
+	return out
+}
+
+func TestCandidates(t *testing.T) {
+	urls := []string{"ldap://a", "ldap://b", "ldap://c"}
+
+	rr := testServers(t, config.ServerRoundRobin, urls...)
+	if got := firsts(rr, 30); got["ldap://a"] != 10 || got["ldap://b"] != 10 || got["ldap://c"] != 10 {
+		t.Fatalf("round-robin not evenly spread: %v", got)
+	}
+
+	random := testServers(t, config.ServerRandom, urls...)
+	if got := firsts(random, 300); len(got) != 3 || got["ldap://a"] < 50 || got["ldap://b"] < 50 || got["ldap://c"] < 50 {
+		t.Fatalf("random not spread: %v", got)
+	}
+
+	least := testServers(t, config.ServerLeastInFlight, urls...)
+	least.servers[0].inFlight.Store(5)
+	least.servers[1].inFlight.Store(1)
+	least.servers[2].inFlight.Store(3)
+	if got := least.candidates(); got[0].url != "ldap://b" || got[1].url != "ldap://c" || got[2].url != "ldap://a" {
+		t.Fatalf("least-inflight order: %s %s %s", got[0].url, got[1].url, got[2].url)
+	}
+
+	// A server marked down is only tried last.
+	rr.markDown(rr.servers[0])
+	for range 6 {
+		if got := rr.candidates(); got[2].url != "ldap://a" {
+			t.Fatalf("down server not last: %s", got[2].url)
+		}
+	}
+}
+
+func TestConnect_Failover(t *testing.T) {
+	// A port nobody listens on anymore.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	downURL := "ldap://" + closed.Addr().String()
+	closed.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			defer conn.Close()
+		}
+	}()
+
+	upURL := "ldap://" + ln.Addr().String()
+	c := testServers(t, config.ServerRoundRobin, downURL, upURL)
+
+	l, s, err := c.connect(c.candidates())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	l.Close()
+
+	if s.url != upURL {
+		t.Fatalf("connected to %s, want failover to %s", s.url, upURL)
+	}
+
+	if got := c.m.Failovers.Load(); got != 1 {
+		t.Fatalf("failovers = %d, want 1", got)
+	}
+
+	if got := c.m.Server(downURL).Fail.Load(); got != 1 {
+		t.Fatalf("failed connects of %s = %d, want 1", downURL, got)
+	}
+
+	if !c.servers[0].down(time.Now().UnixNano()) {
+		t.Fatalf("expected %s to be marked down", downURL)
+	}
+
+	// With the only working server gone, connect gives up after one down
+	// server instead of trying all of them.
+	c.servers = c.servers[:1]
+	if _, _, err := c.connect(c.candidates()); err == nil || ErrorClass(err) != ClassDial {
+		t.Fatalf("expected dial error, got %v", err)
+	}
+}
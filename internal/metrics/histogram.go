@@ -0,0 +1,259 @@
+package metrics
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Histogram precision limits in significant decimal digits.
+const (
+	MinPrecision     = 1
+	MaxPrecision     = 4
+	DefaultPrecision = 3
+)
+
+// maxBits bounds the latencies resolved by a histogram to below 2^42 ns
+// (about 73 minutes). Larger values are counted in the highest bucket; Max
+// still reports them exactly.
+const maxBits = 42
+
+// Histogram is a fixed-memory log-linear (HDR style) histogram of durations in
+// nanoseconds. Values below 2^subBits are counted exactly. Above that, every
+// power-of-two range is split into 2^(subBits-1) linear sub-buckets, so the
+// relative error of any reported percentile is at most 2^-(subBits-1), which is
+// below 10^-precision. Memory depends only on the precision, not on the number
+// of recorded values. Histogram is not safe for concurrent use.
+type Histogram struct {
+	subBits  uint
+	counts   []int64 // allocated on first use
+	total    int64
+	sum      int64
+	min, max int64
+}
+
+// NewHistogram creates a histogram that keeps precision significant decimal
+// digits (clamped to MinPrecision..MaxPrecision; 0 selects DefaultPrecision).
+func NewHistogram(precision int) *Histogram {
+	if precision == 0 {
+		precision = DefaultPrecision
+	}
+
+	precision = max(MinPrecision, min(precision, MaxPrecision))
+
+	// Smallest sub-bucket count 2^subBits with 2^(subBits-1) >= 10^precision.
+	subBits := uint(bits.Len64(uint64(2*math.Pow10(precision)) - 1))
+
+	return &Histogram{subBits: subBits}
+}
+
+// size returns the number of buckets.
+func (h *Histogram) size() int {
+	subCount := 1 << h.subBits
+	maxExp := maxBits - int(h.subBits)
+
+	return subCount + maxExp*(subCount/2)
+}
+
+// index returns the bucket of value v (v >= 0).
+func (h *Histogram) index(v int64) int {
+	subCount := int64(1) << h.subBits
+	if v < subCount {
+		return int(v)
+	}
+
+	if v >= 1<<maxBits {
+		v = 1<<maxBits - 1
+	}
+
+	exp := bits.Len64(uint64(v)) - int(h.subBits)
+	mantissa := v >> exp
+	half := subCount / 2
+
+	return int(subCount + int64(exp-1)*half + (mantissa - half))
+}
+
+// highest returns the largest value that maps to bucket idx.
+func (h *Histogram) highest(idx int) int64 {
+	subCount := 1 << h.subBits
+	if idx < subCount {
+		return int64(idx)
+	}
+
+	half := subCount / 2
+	exp := (idx-subCount)/half + 1
+	mantissa := int64(half + (idx-subCount)%half)
+
+	return (mantissa+1)<<exp - 1
+}
+
+// Record adds a single duration. Negative durations are recorded as zero.
+func (h *Histogram) Record(d time.Duration) {
+	v := max(int64(d), 0)
+
+	if h.counts == nil {
+		h.counts = make([]int64, h.size())
+	}
+
+	h.counts[h.index(v)]++
+
+	if h.total == 0 || v < h.min {
+		h.min = v
+	}
+
+	if v > h.max {
+		h.max = v
+	}
+
+	h.total++
+	h.sum += v
+}
+
+// Merge adds all values recorded in o. When the precisions differ, the buckets
+// of o are re-bucketed at their upper bounds.
+func (h *Histogram) Merge(o *Histogram) {
+	if o == nil || o.total == 0 {
+		return
+	}
+
+	if h.counts == nil {
+		h.counts = make([]int64, h.size())
+	}
+
+	if h.subBits == o.subBits {
+		for i, n := range o.counts {
+			h.counts[i] += n
+		}
+	} else {
+		for i, n := range o.counts {
+			if n > 0 {
+				h.counts[h.index(o.highest(i))] += n
+			}
+		}
+	}
+
+	if h.total == 0 || o.min < h.min {
+		h.min = o.min
+	}
+
+	if o.max > h.max {
+		h.max = o.max
+	}
+
+	h.total += o.total
+	h.sum += o.sum
+}
+
+// Reset clears all recorded values while keeping the allocated buckets.
+func (h *Histogram) Reset() {
+	clear(h.counts)
+	h.total, h.sum, h.min, h.max = 0, 0, 0, 0
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() int64 { return h.total }
+
+// Min returns the smallest recorded value.
+func (h *Histogram) Min() time.Duration { return time.Duration(h.min) }
+
+// Max returns the largest recorded value.
+func (h *Histogram) Max() time.Duration { return time.Duration(h.max) }
+
+// Sum returns the sum of all recorded values.
+func (h *Histogram) Sum() time.Duration { return time.Duration(h.sum) }
+
+// CountAtOrBelow returns the number of recorded values whose bucket lies
+// entirely at or below d, i.e. a cumulative bucket count with the histogram's
+// relative precision.
+func (h *Histogram) CountAtOrBelow(d time.Duration) int64 {
+	if h.total == 0 || d < 0 {
+		return 0
+	}
+
+	if int64(d) >= h.max {
+		return h.total
+	}
+
+	var n int64
+	for i, c := range h.counts {
+		if h.highest(i) > int64(d) {
+			break
+		}
+
+		n += c
+	}
+
+	return n
+}
+
+// Mean returns the exact average of all recorded values.
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+
+	return time.Duration(h.sum / h.total)
+}
+
+// Percentile returns the value at quantile q (0..1) using the nearest-rank
+// method. The result is the upper bound of the bucket holding that rank,
+// limited to the observed min/max.
+func (h *Histogram) Percentile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+
+	if q <= 0 {
+		return time.Duration(h.min)
+	}
+
+	if q >= 1 {
+		return time.Duration(h.max)
+	}
+
+	rank := int64(math.Ceil(q * float64(h.total)))
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			if i == len(h.counts)-1 {
+				// the last bucket also holds values beyond 2^maxBits
+				return time.Duration(h.max)
+			}
+
+			return time.Duration(max(h.min, min(h.highest(i), h.max)))
+		}
+	}
+
+	return time.Duration(h.max)
+}
+
+// Stats summarizes the histogram.
+func (h *Histogram) Stats() LatencyStats {
+	if h.total == 0 {
+		return LatencyStats{}
+	}
+
+	return LatencyStats{
+		Count: h.total,
+		Avg:   h.Mean(),
+		Min:   h.Min(),
+		Max:   h.Max(),
+		P50:   h.Percentile(0.50),
+		P95:   h.Percentile(0.95),
+		P99:   h.Percentile(0.99),
+		P999:  h.Percentile(0.999),
+		P9999: h.Percentile(0.9999),
+	}
+}
+
+// clone returns a deep copy of h.
+func (h *Histogram) clone() *Histogram {
+	c := *h
+	if h.counts != nil {
+		c.counts = make([]int64, len(h.counts))
+		copy(c.counts, h.counts)
+	}
+
+	return &c
+}
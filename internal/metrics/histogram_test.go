@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"math"
+	"math/rand/v2"
+	"sort"
+	"testing"
+	"time"
+)
+
+// exactPercentile returns the nearest-rank percentile of sorted values.
+func exactPercentile(sorted []time.Duration, q float64) time.Duration {
+	rank := int(math.Ceil(q * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+func TestHistogram_PercentileErrorBound(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	// log-normal latencies around 1ms with a long tail up to seconds
+	values := make([]time.Duration, 200000)
+	for i := range values {
+		values[i] = time.Duration(math.Exp(rng.NormFloat64()*1.5) * float64(time.Millisecond))
+	}
+
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	for precision := MinPrecision; precision <= MaxPrecision; precision++ {
+		h := NewHistogram(precision)
+		for _, v := range values {
+			h.Record(v)
+		}
+
+		bound := math.Pow10(-precision)
+		for _, q := range []float64{0.5, 0.9, 0.95, 0.99, 0.999, 0.9999} {
+			want := exactPercentile(sorted, q)
+			got := h.Percentile(q)
+
+			if got < want {
+				t.Fatalf("precision %d q=%v: got %v below exact %v", precision, q, got, want)
+			}
+
+			if rel := float64(got-want) / float64(want); rel > bound {
+				t.Fatalf("precision %d q=%v: got %v, exact %v, relative error %.6f > %.6f", precision, q, got, want, rel, bound)
+			}
+		}
+
+		if h.Min() != sorted[0] || h.Max() != sorted[len(sorted)-1] {
+			t.Fatalf("precision %d: min/max mismatch: %v/%v", precision, h.Min(), h.Max())
+		}
+	}
+}
+
+func TestHistogram_ExactBelowSubBucketRange(t *testing.T) {
+	h := NewHistogram(3)
+	for v := 1; v <= 1000; v++ {
+		h.Record(time.Duration(v))
+	}
+
+	if got := h.Percentile(0.5); got != 500 {
+		t.Fatalf("p50 = %v, want 500ns", got)
+	}
+
+	if got := h.Mean(); got != 500 {
+		t.Fatalf("mean = %v, want 500ns", got)
+	}
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	a, b, all := NewHistogram(3), NewHistogram(3), NewHistogram(3)
+	for i := 1; i <= 5000; i++ {
+		d := time.Duration(i) * time.Microsecond
+		all.Record(d)
+
+		if i%2 == 0 {
+			a.Record(d)
+		} else {
+			b.Record(d)
+		}
+	}
+
+	a.Merge(b)
+
+	if a.Stats() != all.Stats() {
+		t.Fatalf("merged stats differ:\n got %+v\nwant %+v", a.Stats(), all.Stats())
+	}
+
+	// merging a lower precision histogram keeps counts and extremes
+	low := NewHistogram(1)
+	low.Record(time.Second)
+	a.Merge(low)
+
+	if a.Count() != 5001 || a.Max() != time.Second {
+		t.Fatalf("cross-precision merge mismatch: count=%d max=%v", a.Count(), a.Max())
+	}
+}
+
+func TestHistogram_ClampsLargeValues(t *testing.T) {
+	h := NewHistogram(2)
+	h.Record(3 * time.Hour)
+	h.Record(-time.Second)
+
+	if h.Max() != 3*time.Hour || h.Min() != 0 {
+		t.Fatalf("unexpected extremes: min=%v max=%v", h.Min(), h.Max())
+	}
+
+	if got := h.Percentile(0.99); got != 3*time.Hour {
+		t.Fatalf("p99 = %v, want max", got)
+	}
+}
+
+func TestHistogram_CountAtOrBelow(t *testing.T) {
+	h := NewHistogram(3)
+	for i := 1; i <= 100; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	if got := h.CountAtOrBelow(50 * time.Millisecond); got < 49 || got > 50 {
+		t.Fatalf("count at or below 50ms = %d, want about 50", got)
+	}
+
+	if got := h.CountAtOrBelow(time.Hour); got != 100 {
+		t.Fatalf("count at or below 1h = %d, want 100", got)
+	}
+
+	if h.Sum() != 5050*time.Millisecond {
+		t.Fatalf("sum = %v", h.Sum())
+	}
+}
+
+func TestLatencyRecorder_WindowAndTotal(t *testing.T) {
+	l := NewLatencyRecorder(3)
+	l.Record(time.Millisecond)
+	l.Record(3 * time.Millisecond)
+
+	w := l.WindowSnapshotAndReset()
+	if w.Count != 2 || w.Avg != 2*time.Millisecond {
+		t.Fatalf("unexpected window stats: %+v", w)
+	}
+
+	l.Record(5 * time.Millisecond)
+
+	if w := l.WindowSnapshotAndReset(); w.Count != 1 || w.Min != 5*time.Millisecond {
+		t.Fatalf("window not reset: %+v", w)
+	}
+
+	l.Record(7 * time.Millisecond)
+
+	tot := l.TotalSnapshot()
+	if tot.Count != 4 || tot.Min != time.Millisecond || tot.Max != 7*time.Millisecond {
+		t.Fatalf("unexpected total stats: %+v", tot)
+	}
+}
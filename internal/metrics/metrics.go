@@ -19,13 +19,236 @@ type Metrics struct {
 	Fail     atomic.Int64
 	Start    time.Time
 
+	// CompareTrue and CompareFalse split successful compare operations by
+	// their result (compareTrue vs. compareFalse).
+	CompareTrue  atomic.Int64
+	CompareFalse atomic.Int64
+
+	// PolicyFail counts password changes rejected by the server's password
+	// policy. These are also included in Fail.
+	PolicyFail atomic.Int64
+
+	// Negative test cases (CSV rows with expected_ok=false): Negative counts
+	// their iterations, which end in exactly one of ExpectedFail (failed as
+	// expected; counted in Success), UnexpectedSuccess or UnexpectedFail
+	// (failed with another result code than expected; both counted in Fail).
+	Negative          atomic.Int64
+	ExpectedFail      atomic.Int64
+	UnexpectedSuccess atomic.Int64
+	UnexpectedFail    atomic.Int64
+
 	// Lat holds per-request latency measurements.
 	Lat *LatencyRecorder
+
+	// Late counts open-loop iterations that started later than the late
+	// threshold after their intended time; Dropped counts scheduled
+	// iterations discarded because the backlog was full.
+	Late    atomic.Int64
+	Dropped atomic.Int64
+
+	// Gauges: iterations currently executing, open LDAP connections (lookup
+	// and pooled user connections) and idle user connections in the pool.
+	InFlight  atomic.Int64
+	OpenConns atomic.Int64
+	PoolIdle  atomic.Int64
+
+	// Failovers counts connections moved to another server because the
+	// chosen one failed to connect.
+	Failovers atomic.Int64
+
+	// Reconnects counts lookup connections re-dialed and re-bound after
+	// they broke; ReconnectFailures the attempts that failed.
+	Reconnects        atomic.Int64
+	ReconnectFailures atomic.Int64
+
+	// DNCacheHits and DNCacheMisses count DN lookups answered from the DN
+	// cache and those that had to search.
+	DNCacheHits   atomic.Int64
+	DNCacheMisses atomic.Int64
+
+	// Retired counts user connections unbound and closed by the connection
+	// policy (per operation, maximum age or uses).
+	Retired atomic.Int64
+
+	// ops holds per-operation metrics (bind, search, compare, ...) and
+	// phases the metrics of the steps inside operations (dial, tls, lookup,
+	// bind, search), both keyed by name.
+	ops    registry
+	phases registry
+
+	// servers holds the requests sent to each LDAP server, keyed by URL.
+	servers registry
+
+	// stages holds the stages of a load profile.
+	stages stageList
+
+	// warmup holds the bucket of the warm-up phase.
+	warmup warmupState
+
+	// errors counts failed attempts by error class.
+	errMu  sync.Mutex
+	errors map[string]*atomic.Int64
+}
+
+// Phase names recorded by the LDAP client and, for schedule, by the
+// open-loop runner.
+const (
+	PhaseDial   = "dial"   // TCP or Unix socket connect
+	PhaseTLS    = "tls"    // TLS handshake (ldaps:// or StartTLS)
+	PhaseLookup = "lookup" // DN lookup search on the service connection
+	PhaseBind   = "bind"   // user bind (simple or SASL/EXTERNAL)
+	PhaseSearch = "search" // user search after the bind
+	PhaseUnbind = "unbind" // unbind of a user connection retired by the connection policy
+
+	PhaseSchedule = "schedule" // open loop: delay between intended and actual start
+)
+
+// OpMetrics tracks counts and latencies of a single operation type (bind,
+// search, compare, ...) or phase. An iteration may run several operations, so
+// the sums across operations can exceed the iteration-level counters of
+// Metrics.
+type OpMetrics struct {
+	Attempts atomic.Int64
+	Success  atomic.Int64
+	Fail     atomic.Int64
+	Lat      *LatencyRecorder
 }
 
 // New creates a new Metrics struct initialized with the current start time.
 func New() *Metrics {
-	return &Metrics{Start: time.Now(), Lat: NewLatencyRecorder(20000)}
+	return NewWithPrecision(DefaultPrecision)
+}
+
+// NewWithPrecision creates a new Metrics struct whose latency histograms keep
+// precision significant decimal digits.
+func NewWithPrecision(precision int) *Metrics {
+	m := &Metrics{Start: time.Now(), Lat: NewLatencyRecorder(precision)}
+	m.ops.precision = precision
+	m.phases.precision = precision
+	m.servers.precision = precision
+
+	return m
+}
+
+// Op returns the metrics of the named operation, creating them on first use.
+func (m *Metrics) Op(name string) *OpMetrics { return m.ops.get(name) }
+
+// OpNames returns the names of all operations recorded so far, sorted.
+func (m *Metrics) OpNames() []string { return m.ops.names() }
+
+// Phase returns the metrics of the named phase, creating them on first use.
+func (m *Metrics) Phase(name string) *OpMetrics { return m.phases.get(name) }
+
+// PhaseNames returns the names of all phases recorded so far, sorted.
+func (m *Metrics) PhaseNames() []string { return m.phases.names() }
+
+// Server returns the metrics of the LDAP server with the given URL, creating
+// them on first use.
+func (m *Metrics) Server(url string) *OpMetrics { return m.servers.get(url) }
+
+// ServerNames returns the URLs of all servers used so far, sorted.
+func (m *Metrics) ServerNames() []string { return m.servers.names() }
+
+// CountError increments the failure counter of an error class.
+func (m *Metrics) CountError(class string) {
+	m.errMu.Lock()
+	if m.errors == nil {
+		m.errors = make(map[string]*atomic.Int64)
+	}
+
+	c := m.errors[class]
+	if c == nil {
+		c = &atomic.Int64{}
+		m.errors[class] = c
+	}
+	m.errMu.Unlock()
+
+	c.Add(1)
+}
+
+// ErrorCount is the number of failures of one error class.
+type ErrorCount struct {
+	Class string
+	Count int64
+}
+
+// Errors returns the failure counts per error class, most frequent first.
+func (m *Metrics) Errors() []ErrorCount {
+	m.errMu.Lock()
+	out := make([]ErrorCount, 0, len(m.errors))
+	for class, c := range m.errors {
+		out = append(out, ErrorCount{Class: class, Count: c.Load()})
+	}
+	m.errMu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+
+		return out[i].Class < out[j].Class
+	})
+
+	return out
+}
+
+// registry is a concurrency-safe set of OpMetrics keyed by name.
+type registry struct {
+	mu        sync.RWMutex
+	m         map[string]*OpMetrics
+	precision int
+}
+
+// get returns the metrics for name, creating them on first use.
+func (g *registry) get(name string) *OpMetrics {
+	g.mu.RLock()
+	om := g.m[name]
+	g.mu.RUnlock()
+
+	if om != nil {
+		return om
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.m == nil {
+		g.m = make(map[string]*OpMetrics)
+	}
+
+	if om = g.m[name]; om == nil {
+		om = &OpMetrics{Lat: NewLatencyRecorder(g.precision)}
+		g.m[name] = om
+	}
+
+	return om
+}
+
+// names returns all registered names, sorted.
+func (g *registry) names() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	names := make([]string, 0, len(g.m))
+	for name := range g.m {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Record adds the outcome and latency of one operation.
+func (o *OpMetrics) Record(d time.Duration, err error) {
+	o.Attempts.Add(1)
+	if err != nil {
+		o.Fail.Add(1)
+	} else {
+		o.Success.Add(1)
+	}
+
+	o.Lat.Record(d)
 }
 
 // Snapshot returns current counts and elapsed time. RPS is not computed here
@@ -44,141 +267,66 @@ func (m *Metrics) Snapshot() (attempts, success, fail int64, elapsed time.Durati
 type LatencyStats struct {
 	Count int64
 	Avg   time.Duration
+	Min   time.Duration
+	Max   time.Duration
 	P50   time.Duration
 	P95   time.Duration
 	P99   time.Duration
+	P999  time.Duration
+	P9999 time.Duration
 }
 
 // LatencyRecorder collects latencies both for a complete run (cumulative) and
-// for the current reporting window (window). It keeps a bounded sample of the
-// cumulative latencies to compute percentiles without unbounded memory growth.
+// for the current reporting window (window). Both are fixed-memory histograms,
+// so memory stays constant regardless of request rate and interval length.
+// Values are recorded into the window and folded into the cumulative histogram
+// when the window is reset.
 type LatencyRecorder struct {
 	mu sync.Mutex
 
-	// cumulative
-	totalCount int64
-	totalSum   time.Duration
-	// reservoir sample for percentiles (bounded by cap)
-	sample []time.Duration
-	cap    int
-
-	// window collects raw latencies since last window snapshot
-	window []time.Duration
+	total  *Histogram
+	window *Histogram
 }
 
-// NewLatencyRecorder creates a recorder with a bounded reservoir capacity for
-// cumulative percentile calculations. A capacity of 0 disables sampling (no
-// percentiles for cumulative stats), but averages still work.
-func NewLatencyRecorder(capacity int) *LatencyRecorder {
-	if capacity < 0 {
-		capacity = 0
-	}
-
-	return &LatencyRecorder{cap: capacity, sample: make([]time.Duration, 0, min(capacity, 1024))}
+// NewLatencyRecorder creates a recorder whose histograms keep precision
+// significant decimal digits (see NewHistogram).
+func NewLatencyRecorder(precision int) *LatencyRecorder {
+	return &LatencyRecorder{total: NewHistogram(precision), window: NewHistogram(precision)}
 }
 
 // Record adds a single latency measurement.
 func (l *LatencyRecorder) Record(d time.Duration) {
 	l.mu.Lock()
-	l.totalCount++
-	l.totalSum += d
-
-	// reservoir sampling: fill up to cap, then replace randomly
-	if l.cap > 0 {
-		if len(l.sample) < l.cap {
-			l.sample = append(l.sample, d)
-		} else {
-			// simple reservoir: random index in [0, totalCount)
-			// replace if index within sample range
-			idx := int(time.Now().UnixNano() % l.totalCount)
-			if idx < l.cap {
-				l.sample[idx] = d
-			}
-		}
-	}
-
-	// always store in current window
-	l.window = append(l.window, d)
+	l.window.Record(d)
 	l.mu.Unlock()
 }
 
 // TotalSnapshot returns cumulative latency statistics for the entire run so far.
 func (l *LatencyRecorder) TotalSnapshot() LatencyStats {
+	return l.Total().Stats()
+}
+
+// Total returns a copy of the cumulative histogram including the current
+// window. The copy can be merged with other histograms.
+func (l *LatencyRecorder) Total() *Histogram {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	var avg time.Duration
-	if l.totalCount > 0 {
-		avg = time.Duration(int64(l.totalSum) / l.totalCount)
-	}
-
-	// compute percentiles from sample (best-effort)
-	var p50, p95, p99 time.Duration
-	if n := len(l.sample); n > 0 {
-		tmp := make([]time.Duration, n)
-		copy(tmp, l.sample)
-		sort.Slice(tmp, func(i, j int) bool { return tmp[i] < tmp[j] })
-		p50 = percentile(tmp, 0.50)
-		p95 = percentile(tmp, 0.95)
-		p99 = percentile(tmp, 0.99)
-	}
+	h := l.total.clone()
+	h.Merge(l.window)
 
-	return LatencyStats{Count: l.totalCount, Avg: avg, P50: p50, P95: p95, P99: p99}
+	return h
 }
 
 // WindowSnapshotAndReset returns latency stats for the current reporting window
-// and resets the window. Percentiles are exact for the window since it uses the
-// full data collected for that interval.
+// and resets the window.
 func (l *LatencyRecorder) WindowSnapshotAndReset() LatencyStats {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	n := len(l.window)
-	if n == 0 {
-		return LatencyStats{}
-	}
-
-	tmp := make([]time.Duration, n)
-	copy(tmp, l.window)
-	l.window = l.window[:0]
-
-	// compute aggregates
-	var sum time.Duration
-	for _, d := range tmp {
-		sum += d
-	}
-
-	avg := time.Duration(int64(sum) / int64(n))
-	sort.Slice(tmp, func(i, j int) bool { return tmp[i] < tmp[j] })
-	p50 := percentile(tmp, 0.50)
-	p95 := percentile(tmp, 0.95)
-	p99 := percentile(tmp, 0.99)
-
-	return LatencyStats{Count: int64(n), Avg: avg, P50: p50, P95: p95, P99: p99}
-}
-
-func percentile(sorted []time.Duration, p float64) time.Duration {
-	if len(sorted) == 0 {
-		return 0
-	}
-
-	if p <= 0 {
-		return sorted[0]
-	}
-
-	if p >= 1 {
-		return sorted[len(sorted)-1]
-	}
-
-	// nearest-rank method
-	rank := int(float64(len(sorted)) * p)
-	if rank <= 0 {
-		return sorted[0]
-	}
-
-	if rank >= len(sorted) {
-		return sorted[len(sorted)-1]
-	}
+	stats := l.window.Stats()
+	l.total.Merge(l.window)
+	l.window.Reset()
 
-	return sorted[rank]
+	return stats
 }
@@ -24,3 +24,27 @@ func TestNewAndSnapshot(t *testing.T) {
 		t.Fatalf("elapsed should be > 0, got %v", el)
 	}
 }
+
+func TestWarmupBucket(t *testing.T) {
+	m := New()
+	if m.Bucket() != m || m.Warmup() != nil || !m.WarmupEnd().IsZero() {
+		t.Fatalf("unexpected warm-up state before BeginWarmup")
+	}
+
+	w := m.BeginWarmup()
+	if m.Bucket() != w || w == m || !m.WarmingUp() {
+		t.Fatalf("Bucket should return the warm-up bucket while warming up")
+	}
+
+	m.Bucket().Attempts.Add(3)
+	m.EndWarmup()
+	m.Bucket().Attempts.Add(1)
+
+	if m.Bucket() != m || m.WarmingUp() || m.WarmupEnd().IsZero() {
+		t.Fatalf("Bucket should return m after EndWarmup")
+	}
+
+	if m.Warmup().Attempts.Load() != 3 || m.Attempts.Load() != 1 {
+		t.Fatalf("attempts not separated: warmup=%d main=%d", m.Warmup().Attempts.Load(), m.Attempts.Load())
+	}
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// StageMetrics tracks the iterations of one stage of a load profile. The
+// counters and latencies cover whole iterations like the top-level ones.
+type StageMetrics struct {
+	OpMetrics
+
+	Name  string
+	Start time.Time
+	end   atomic.Int64 // UnixNano; 0 while the stage is running
+}
+
+// Elapsed returns how long the stage ran, or has been running so far.
+func (s *StageMetrics) Elapsed() time.Duration {
+	if end := s.end.Load(); end != 0 {
+		return time.Unix(0, end).Sub(s.Start)
+	}
+
+	return time.Since(s.Start)
+}
+
+// stageList holds the stages in the order they were started.
+type stageList struct {
+	all atomic.Pointer[[]*StageMetrics]
+	cur atomic.Pointer[StageMetrics]
+}
+
+// BeginStage ends the current stage, if any, and starts recording into a new
+// stage called name. BeginStage and EndStage must not be called concurrently.
+func (m *Metrics) BeginStage(name string) *StageMetrics {
+	m.EndStage()
+
+	st := &StageMetrics{OpMetrics: OpMetrics{Lat: NewLatencyRecorder(m.ops.precision)}, Name: name, Start: time.Now()}
+
+	var all []*StageMetrics
+	if p := m.stages.all.Load(); p != nil {
+		all = append(all, *p...)
+	}
+
+	all = append(all, st)
+	m.stages.all.Store(&all)
+	m.stages.cur.Store(st)
+
+	return st
+}
+
+// EndStage marks the current stage finished.
+func (m *Metrics) EndStage() {
+	if st := m.stages.cur.Swap(nil); st != nil {
+		st.end.Store(time.Now().UnixNano())
+	}
+}
+
+// Stage returns the running stage, or nil outside of a load profile.
+func (m *Metrics) Stage() *StageMetrics { return m.stages.cur.Load() }
+
+// Stages returns all stages started so far in order.
+func (m *Metrics) Stages() []*StageMetrics {
+	if p := m.stages.all.Load(); p != nil {
+		return *p
+	}
+
+	return nil
+}
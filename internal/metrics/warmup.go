@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// warmupState holds the separate bucket that receives all measurements during
+// the warm-up phase so they do not skew the totals.
+type warmupState struct {
+	bucket  atomic.Pointer[Metrics] // kept after the warm-up ended
+	running atomic.Bool
+	end     atomic.Int64 // UnixNano; 0 until the warm-up ended
+}
+
+// BeginWarmup starts the warm-up phase. Until EndWarmup, Bucket returns a
+// separate Metrics instance.
+func (m *Metrics) BeginWarmup() *Metrics {
+	w := NewWithPrecision(m.ops.precision)
+	m.warmup.bucket.Store(w)
+	m.warmup.running.Store(true)
+
+	return w
+}
+
+// EndWarmup ends the warm-up phase; measurements go to m again.
+func (m *Metrics) EndWarmup() {
+	if m.warmup.running.Swap(false) {
+		m.warmup.end.Store(time.Now().UnixNano())
+	}
+}
+
+// Bucket returns the Metrics that iterations starting now record into: the
+// warm-up bucket during the warm-up phase and m otherwise. Gauges are only
+// kept on m.
+func (m *Metrics) Bucket() *Metrics {
+	if m.warmup.running.Load() {
+		return m.warmup.bucket.Load()
+	}
+
+	return m
+}
+
+// WarmingUp reports whether the warm-up phase is running.
+func (m *Metrics) WarmingUp() bool { return m.warmup.running.Load() }
+
+// Warmup returns the warm-up bucket, or nil when the run had no warm-up.
+func (m *Metrics) Warmup() *Metrics { return m.warmup.bucket.Load() }
+
+// WarmupEnd returns when the warm-up phase ended, or the zero time.
+func (m *Metrics) WarmupEnd() time.Time {
+	if end := m.warmup.end.Load(); end != 0 {
+		return time.Unix(0, end)
+	}
+
+	return time.Time{}
+}
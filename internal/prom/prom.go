@@ -0,0 +1,228 @@
+// Package prom serves the live benchmark metrics in the Prometheus text
+// exposition format (version 0.0.4) without external dependencies.
+package prom
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/croessner/ldapbench/internal/metrics"
+)
+
+// buckets are the upper bounds of the exported latency histograms.
+var buckets = []time.Duration{
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Server serves /metrics on a TCP listener.
+type Server struct {
+	ln  net.Listener
+	srv *http.Server
+}
+
+// Listen binds addr (host:port) and prepares the metrics endpoint. Call Serve
+// to start answering requests.
+func Listen(addr string, m *metrics.Metrics) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("metrics listen: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler(m))
+
+	return &Server{ln: ln, srv: &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}}, nil
+}
+
+// Addr returns the bound listen address.
+func (s *Server) Addr() string { return s.ln.Addr().String() }
+
+// Serve answers requests until Close is called.
+func (s *Server) Serve() error {
+	if err := s.srv.Serve(s.ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// Close stops the server.
+func (s *Server) Close() error { return s.srv.Close() }
+
+// Handler returns an http.Handler writing the current metrics.
+func Handler(m *metrics.Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		bw := bufio.NewWriter(w)
+		Write(bw, m)
+		_ = bw.Flush()
+	})
+}
+
+// Write writes all metrics of m in the Prometheus text format.
+func Write(w io.Writer, m *metrics.Metrics) {
+	counter(w, "ldapbench_attempts_total", "Benchmark iterations started.", m.Attempts.Load())
+	counter(w, "ldapbench_success_total", "Benchmark iterations that succeeded.", m.Success.Load())
+	counter(w, "ldapbench_failures_total", "Benchmark iterations that failed.", m.Fail.Load())
+	counter(w, "ldapbench_password_policy_failures_total", "Password changes rejected by the password policy.", m.PolicyFail.Load())
+
+	header(w, "ldapbench_negative_results_total", "counter", "Outcomes of negative test cases (expected_ok=false).")
+	sample(w, "ldapbench_negative_results_total", labels("result", "expected_failure"), m.ExpectedFail.Load())
+	sample(w, "ldapbench_negative_results_total", labels("result", "unexpected_success"), m.UnexpectedSuccess.Load())
+	sample(w, "ldapbench_negative_results_total", labels("result", "unexpected_failure"), m.UnexpectedFail.Load())
+
+	counter(w, "ldapbench_late_total", "Open-loop iterations started later than the late threshold.", m.Late.Load())
+	counter(w, "ldapbench_dropped_total", "Open-loop schedules dropped because the backlog was full.", m.Dropped.Load())
+	counter(w, "ldapbench_failovers_total", "Connections moved to another server because the chosen one failed.", m.Failovers.Load())
+
+	header(w, "ldapbench_lookup_reconnects_total", "counter", "Attempts to re-establish a broken lookup connection by result.")
+	sample(w, "ldapbench_lookup_reconnects_total", labels("result", "success"), m.Reconnects.Load())
+	sample(w, "ldapbench_lookup_reconnects_total", labels("result", "failure"), m.ReconnectFailures.Load())
+
+	counter(w, "ldapbench_connections_retired_total", "User connections unbound and closed by the connection policy.", m.Retired.Load())
+
+	header(w, "ldapbench_dn_cache_requests_total", "counter", "DN lookups by DN cache result.")
+	sample(w, "ldapbench_dn_cache_requests_total", labels("result", "hit"), m.DNCacheHits.Load())
+	sample(w, "ldapbench_dn_cache_requests_total", labels("result", "miss"), m.DNCacheMisses.Load())
+
+	header(w, "ldapbench_compare_results_total", "counter", "Successful compare operations by result.")
+	sample(w, "ldapbench_compare_results_total", labels("result", "true"), m.CompareTrue.Load())
+	sample(w, "ldapbench_compare_results_total", labels("result", "false"), m.CompareFalse.Load())
+
+	header(w, "ldapbench_errors_total", "counter", "Failures by error class.")
+	for _, e := range m.Errors() {
+		sample(w, "ldapbench_errors_total", labels("class", e.Class), e.Count)
+	}
+
+	var warmup int64
+	if m.WarmingUp() {
+		warmup = 1
+	}
+
+	gauge(w, "ldapbench_warmup", "1 while the warm-up phase runs; counters and histograms exclude it.", warmup)
+	gauge(w, "ldapbench_in_flight", "Iterations currently executing.", m.InFlight.Load())
+	gauge(w, "ldapbench_connections_open", "Open LDAP connections.", m.OpenConns.Load())
+	gauge(w, "ldapbench_pool_idle_connections", "Idle user connections in the pool.", m.PoolIdle.Load())
+
+	header(w, "ldapbench_start_time_seconds", "gauge", "Start time of the run since the Unix epoch.")
+	fmt.Fprintf(w, "ldapbench_start_time_seconds %s\n", float(float64(m.Start.UnixNano())/1e9))
+
+	ops := m.OpNames()
+
+	header(w, "ldapbench_operation_attempts_total", "counter", "Operations executed by type.")
+	for _, name := range ops {
+		sample(w, "ldapbench_operation_attempts_total", labels("op", name), m.Op(name).Attempts.Load())
+	}
+
+	header(w, "ldapbench_operation_failures_total", "counter", "Failed operations by type.")
+	for _, name := range ops {
+		sample(w, "ldapbench_operation_failures_total", labels("op", name), m.Op(name).Fail.Load())
+	}
+
+	servers := m.ServerNames()
+
+	header(w, "ldapbench_server_requests_total", "counter", "Requests sent by LDAP server.")
+	for _, name := range servers {
+		sample(w, "ldapbench_server_requests_total", labels("server", name), m.Server(name).Attempts.Load())
+	}
+
+	header(w, "ldapbench_server_failures_total", "counter", "Failed requests by LDAP server.")
+	for _, name := range servers {
+		sample(w, "ldapbench_server_failures_total", labels("server", name), m.Server(name).Fail.Load())
+	}
+
+	header(w, "ldapbench_request_duration_seconds", "histogram", "Latency of whole iterations including the DN lookup.")
+	histogram(w, "ldapbench_request_duration_seconds", "", m.Lat.Total())
+
+	header(w, "ldapbench_operation_duration_seconds", "histogram", "Latency of operations by type.")
+	for _, name := range ops {
+		histogram(w, "ldapbench_operation_duration_seconds", labels("op", name), m.Op(name).Lat.Total())
+	}
+
+	header(w, "ldapbench_server_duration_seconds", "histogram", "Latency of requests by LDAP server.")
+	for _, name := range servers {
+		histogram(w, "ldapbench_server_duration_seconds", labels("server", name), m.Server(name).Lat.Total())
+	}
+
+	header(w, "ldapbench_phase_duration_seconds", "histogram", "Latency of connection and request phases.")
+	for _, name := range m.PhaseNames() {
+		histogram(w, "ldapbench_phase_duration_seconds", labels("phase", name), m.Phase(name).Lat.Total())
+	}
+}
+
+func header(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func counter(w io.Writer, name, help string, v int64) {
+	header(w, name, "counter", help)
+	sample(w, name, "", v)
+}
+
+func gauge(w io.Writer, name, help string, v int64) {
+	header(w, name, "gauge", help)
+	sample(w, name, "", v)
+}
+
+func sample(w io.Writer, name, lbls string, v int64) {
+	fmt.Fprintf(w, "%s%s %d\n", name, braces(lbls), v)
+}
+
+// histogram writes the cumulative buckets, sum and count of h.
+func histogram(w io.Writer, name, lbls string, h *metrics.Histogram) {
+	for _, b := range buckets {
+		le := labels("le", float(b.Seconds()))
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, braces(join(lbls, le)), h.CountAtOrBelow(b))
+	}
+
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, braces(join(lbls, labels("le", "+Inf"))), h.Count())
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, braces(lbls), float(h.Sum().Seconds()))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, braces(lbls), h.Count())
+}
+
+// labels formats a single name="value" pair with the value escaped.
+func labels(name, value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	return name + `="` + r.Replace(value) + `"`
+}
+
+func join(a, b string) string {
+	if a == "" {
+		return b
+	}
+
+	return a + "," + b
+}
+
+func braces(lbls string) string {
+	if lbls == "" {
+		return ""
+	}
+
+	return "{" + lbls + "}"
+}
+
+func float(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
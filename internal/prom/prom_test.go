@@ -0,0 +1,89 @@
+package prom
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/croessner/ldapbench/internal/metrics"
+)
+
+func TestHandler(t *testing.T) {
+	m := metrics.New()
+	m.Attempts.Add(3)
+	m.Fail.Add(1)
+	m.InFlight.Add(2)
+	m.Op("bind").Record(2*time.Millisecond, nil)
+	m.Op("bind").Record(time.Second, errors.New("boom"))
+	m.CountError(`say "hi"`)
+	m.Server("ldap://a:389").Record(time.Millisecond, nil)
+	m.Failovers.Add(1)
+	m.Reconnects.Add(2)
+	m.DNCacheHits.Add(5)
+	m.Retired.Add(7)
+
+	rec := httptest.NewRecorder()
+	Handler(m).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body, _ := io.ReadAll(rec.Body)
+	out := string(body)
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	for _, want := range []string{
+		"# TYPE ldapbench_attempts_total counter\nldapbench_attempts_total 3\n",
+		"ldapbench_failures_total 1\n",
+		"ldapbench_in_flight 2\n",
+		`ldapbench_errors_total{class="say \"hi\""} 1`,
+		`ldapbench_operation_failures_total{op="bind"} 1`,
+		`ldapbench_operation_duration_seconds_bucket{op="bind",le="0.0025"} 1`,
+		`ldapbench_operation_duration_seconds_bucket{op="bind",le="+Inf"} 2`,
+		`ldapbench_operation_duration_seconds_count{op="bind"} 2`,
+		"ldapbench_request_duration_seconds_count 0\n",
+		"ldapbench_failovers_total 1\n",
+		`ldapbench_lookup_reconnects_total{result="success"} 2`,
+		`ldapbench_lookup_reconnects_total{result="failure"} 0`,
+		`ldapbench_dn_cache_requests_total{result="hit"} 5`,
+		"ldapbench_connections_retired_total 7\n",
+		`ldapbench_server_requests_total{server="ldap://a:389"} 1`,
+		`ldapbench_server_duration_seconds_count{server="ldap://a:389"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	s, err := Listen("127.0.0.1:0", metrics.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.Serve() }()
+
+	resp, err := http.Get("http://" + s.Addr() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+}
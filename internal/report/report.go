@@ -6,79 +6,234 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/croessner/ldapbench/internal/metrics"
+	"github.com/croessner/ldapbench/internal/saturate"
 )
 
 // Reporter periodically prints stats to stdout.
 type Reporter struct {
 	m       *metrics.Metrics
 	intv    time.Duration
+	series  *Series
 	stopped atomic.Bool
 }
 
 // New creates a new Reporter instance.
 func New(m *metrics.Metrics, intv time.Duration) *Reporter { return &Reporter{m: m, intv: intv} }
 
+// SetSeries additionally writes every interval sample to s. It must be called
+// before Run.
+func (r *Reporter) SetSeries(s *Series) { r.series = s }
+
 // Run starts the periodic reporting loop until the context is canceled.
 func (r *Reporter) Run(ctx context.Context) {
 	ticker := time.NewTicker(r.intv)
 	defer ticker.Stop()
 
-	var lastAtt int64
-	var lastSuc int64
-	var lastFal int64
-	var lastAt = time.Now()
+	last := newCounters(time.Now())
+	cur := r.m
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case t := <-ticker.C:
-			att := r.m.Attempts.Load()
-			suc := r.m.Success.Load()
-			fal := r.m.Fail.Load()
-
-			// Deltas for the last period
-			deltaAtt := att - lastAtt
-			deltaSuc := suc - lastSuc
-			deltaFal := fal - lastFal
-
-			dur := t.Sub(lastAt).Seconds()
-			rps := 0.0           // Success RPS (successful requests per second in last period)
-			arps := 0.0          // Attempts RPS (all attempts per second in last period)
-			successRate := 0.0   // Overall success rate in % since start
-			intervalSRate := 0.0 // Success rate % in the last period
-
-			if dur > 0 {
-				rps = float64(deltaSuc) / dur
-				arps = float64(deltaAtt) / dur
-			}
+			// During the warm-up phase the samples come from its separate
+			// bucket; counters restart when the measured run begins.
+			cur, last = switchBucket(r.m, cur, last)
 
-			if att > 0 {
-				successRate = (float64(suc) / float64(att)) * 100
-			}
+			s := takeSample(cur, last, t)
+			s.Elapsed = t.Sub(r.m.Start).Seconds()
+			s.Warmup = cur != r.m
+			printSample(os.Stdout, s)
 
-			if deltaAtt > 0 {
-				intervalSRate = (float64(deltaSuc) / float64(deltaAtt)) * 100
+			if r.series != nil {
+				if err := r.series.Write(s); err != nil {
+					fmt.Fprintf(os.Stderr, "stats file error: %v\n", err)
+				}
 			}
+		}
+	}
+}
+
+// switchBucket follows m.Bucket when the warm-up phase begins or ends and
+// then restarts the counters. The first measured interval starts at the end
+// of the warm-up, so its rates do not cover warm-up time.
+func switchBucket(m, cur *metrics.Metrics, last *counters) (*metrics.Metrics, *counters) {
+	b := m.Bucket()
+	if b == cur {
+		return cur, last
+	}
 
-			// window latency stats since last tick
-			wlat := r.m.Lat.WindowSnapshotAndReset()
-			fmt.Printf("[stats] elapsed=%v attempts=%d success=%d fail=%d rps=%.2f arps=%.2f srate=%.2f%% israte=%.2f%% ds=%d df=%d avg=%.2f p50=%.2f p95=%.2f p99=%.2f wcnt=%d\n",
-				time.Since(r.m.Start).Truncate(time.Second), att, suc, fal, rps, arps, successRate, intervalSRate, deltaSuc, deltaFal,
-				float64(wlat.Avg.Microseconds())/1000.0, float64(wlat.P50.Microseconds())/1000.0, float64(wlat.P95.Microseconds())/1000.0, float64(wlat.P99.Microseconds())/1000.0, wlat.Count)
+	at := last.at
+	if end := m.WarmupEnd(); b == m && end.After(at) {
+		at = end
+	}
 
-			lastAtt = att
-			lastSuc = suc
-			lastFal = fal
-			lastAt = t
-		}
+	return b, newCounters(at)
+}
+
+// counters holds the cumulative counters at the previous tick.
+type counters struct {
+	at            time.Time
+	att, suc, fal int64
+	ops           map[string]opCounts
+	errors        map[string]int64
+}
+
+func newCounters(at time.Time) *counters {
+	return &counters{at: at, ops: make(map[string]opCounts), errors: make(map[string]int64)}
+}
+
+// opCounts holds the counters of one operation at the previous tick.
+type opCounts struct {
+	att, suc, fal int64
+}
+
+// takeSample computes the interval sample ending at t, resets all latency
+// windows and updates last with the current counters.
+func takeSample(m *metrics.Metrics, last *counters, t time.Time) Sample {
+	att := m.Attempts.Load()
+	suc := m.Success.Load()
+	fal := m.Fail.Load()
+	period := t.Sub(last.at)
+
+	s := Sample{
+		Time:       t,
+		Elapsed:    t.Sub(m.Start).Seconds(),
+		Stage:      stageName(m),
+		Attempts:   att,
+		Success:    suc,
+		Fail:       fal,
+		Late:       m.Late.Load(),
+		Dropped:    m.Dropped.Load(),
+		RPS:        perSecond(suc-last.suc, period), // successful requests per second in the last period
+		ARPS:       perSecond(att-last.att, period), // all attempts per second in the last period
+		DeltaSucc:  suc - last.suc,
+		DeltaFail:  fal - last.fal,
+		Latency:    latency(m.Lat.WindowSnapshotAndReset()),
+		Phases:     []PhaseSample{},
+		Operations: []OpSample{},
+		Errors:     []ErrorSample{},
+	}
+
+	// Overall success rate since start and in the last period, in %
+	if att > 0 {
+		s.SuccessRate = float64(suc) * 100 / float64(att)
+	}
+
+	if d := att - last.att; d > 0 {
+		s.IntervalSRate = float64(suc-last.suc) * 100 / float64(d)
+	}
+
+	for _, name := range m.PhaseNames() {
+		s.Phases = append(s.Phases, PhaseSample{Name: name, Latency: latency(m.Phase(name).Lat.WindowSnapshotAndReset())})
+	}
+
+	for _, name := range m.OpNames() {
+		om := m.Op(name)
+		cur := opCounts{att: om.Attempts.Load(), suc: om.Success.Load(), fal: om.Fail.Load()}
+		prev := last.ops[name]
+		last.ops[name] = cur
+
+		s.Operations = append(s.Operations, OpSample{
+			Name:      name,
+			Attempts:  cur.att,
+			Success:   cur.suc,
+			Fail:      cur.fal,
+			RPS:       perSecond(cur.suc-prev.suc, period),
+			DeltaSucc: cur.suc - prev.suc,
+			DeltaFail: cur.fal - prev.fal,
+			Latency:   latency(om.Lat.WindowSnapshotAndReset()),
+		})
+	}
+
+	for _, e := range m.Errors() {
+		s.Errors = append(s.Errors, ErrorSample{Class: e.Class, Count: e.Count, Delta: e.Count - last.errors[e.Class]})
+		last.errors[e.Class] = e.Count
+	}
+
+	last.at, last.att, last.suc, last.fal = t, att, suc, fal
+
+	return s
+}
+
+// stageName returns the name of the running stage, or "" without a load
+// profile.
+func stageName(m *metrics.Metrics) string {
+	if st := m.Stage(); st != nil {
+		return st.Name
+	}
+
+	return ""
+}
+
+// printSample prints the [stats] line of s followed by one line per
+// operation; warm-up samples are tagged [warmup] instead. Phase window
+// latencies are appended to the main line as
+// " <phase>_avg=.. <phase>_p99=.. <phase>_cnt=.." fields.
+func printSample(w io.Writer, s Sample) {
+	var phases strings.Builder
+	for _, p := range s.Phases {
+		fmt.Fprintf(&phases, " %s_avg=%.2f %s_p99=%.2f %s_cnt=%d", p.Name, p.Latency.AvgMs, p.Name, p.Latency.P99Ms, p.Name, p.Latency.Count)
+	}
+
+	// Open-loop schedule counters, only when there are any
+	if s.Late+s.Dropped > 0 {
+		fmt.Fprintf(&phases, " late=%d dropped=%d", s.Late, s.Dropped)
+	}
+
+	if s.Stage != "" {
+		fmt.Fprintf(&phases, " stage=%s", s.Stage)
+	}
+
+	tag := "[stats]"
+	if s.Warmup {
+		tag = "[warmup]"
+	}
+
+	elapsed := time.Duration(s.Elapsed * float64(time.Second)).Truncate(time.Second)
+	fmt.Fprintf(w, "%s elapsed=%v attempts=%d success=%d fail=%d rps=%.2f arps=%.2f srate=%.2f%% israte=%.2f%% ds=%d df=%d avg=%.2f p50=%.2f p95=%.2f p99=%.2f wcnt=%d%s\n",
+		tag, elapsed, s.Attempts, s.Success, s.Fail, s.RPS, s.ARPS, s.SuccessRate, s.IntervalSRate, s.DeltaSucc, s.DeltaFail,
+		s.Latency.AvgMs, s.Latency.P50Ms, s.Latency.P95Ms, s.Latency.P99Ms, s.Latency.Count, phases.String())
+
+	for _, o := range s.Operations {
+		fmt.Fprintf(w, "%s op=%s attempts=%d success=%d fail=%d rps=%.2f ds=%d df=%d avg=%.2f p50=%.2f p95=%.2f p99=%.2f wcnt=%d\n",
+			tag, o.Name, o.Attempts, o.Success, o.Fail, o.RPS, o.DeltaSucc, o.DeltaFail,
+			o.Latency.AvgMs, o.Latency.P50Ms, o.Latency.P95Ms, o.Latency.P99Ms, o.Latency.Count)
+	}
+}
+
+// topErrors is the number of error classes listed in the summary.
+const topErrors = 10
+
+// printErrors prints the most frequent error classes as a table with their
+// share of all classified failures.
+func printErrors(w io.Writer, errs []metrics.ErrorCount) {
+	if len(errs) == 0 {
+		return
+	}
+
+	var total int64
+	for _, e := range errs {
+		total += e.Count
+	}
+
+	fmt.Fprintf(w, "errors (top %d of %d classes):\n", min(topErrors, len(errs)), len(errs))
+	fmt.Fprintf(w, "  %-30s %12s %8s\n", "class", "count", "share")
+	for _, e := range errs[:min(topErrors, len(errs))] {
+		fmt.Fprintf(w, "  %-30s %12d %7.2f%%\n", e.Class, e.Count, float64(e.Count)*100/float64(total))
 	}
 }
 
+// ms converts d to fractional milliseconds for printing.
+func ms(d time.Duration) float64 { return float64(d.Microseconds()) / 1000.0 }
+
 // Stop marks the reporter stopped (placeholder for future use).
 func (r *Reporter) Stop() { r.stopped.Store(true) }
 
@@ -100,15 +255,129 @@ func PrintSummary(w io.Writer, m *metrics.Metrics, elapsed time.Duration) {
 	fmt.Fprintf(w, "fail: %d\n", fal)
 	fmt.Fprintf(w, "avg rps (success): %.2f\n", rps)
 
+	if ct, cf := m.CompareTrue.Load(), m.CompareFalse.Load(); ct+cf > 0 {
+		fmt.Fprintf(w, "compare: true=%d false=%d\n", ct, cf)
+	}
+
+	if pf := m.PolicyFail.Load(); pf > 0 {
+		fmt.Fprintf(w, "password policy failures: %d\n", pf)
+	}
+
+	if neg := m.Negative.Load(); neg > 0 {
+		fmt.Fprintf(w, "negative cases: attempts=%d expected_failure=%d unexpected_success=%d unexpected_failure=%d\n",
+			neg, m.ExpectedFail.Load(), m.UnexpectedSuccess.Load(), m.UnexpectedFail.Load())
+	}
+
+	if wm := m.Warmup(); wm != nil {
+		fmt.Fprintf(w, "warmup (excluded): elapsed=%v attempts=%d success=%d fail=%d\n",
+			warmupElapsed(m).Truncate(time.Millisecond), wm.Attempts.Load(), wm.Success.Load(), wm.Fail.Load())
+	}
+
+	if late, dropped := m.Late.Load(), m.Dropped.Load(); late+dropped > 0 {
+		fmt.Fprintf(w, "open loop: late=%d dropped=%d\n", late, dropped)
+	}
+
+	if fo := m.Failovers.Load(); fo > 0 {
+		fmt.Fprintf(w, "failovers: %d\n", fo)
+	}
+
+	if rc, rf := m.Reconnects.Load(), m.ReconnectFailures.Load(); rc+rf > 0 {
+		fmt.Fprintf(w, "lookup reconnects: success=%d fail=%d\n", rc, rf)
+	}
+
+	if hits, misses := m.DNCacheHits.Load(), m.DNCacheMisses.Load(); hits+misses > 0 {
+		fmt.Fprintf(w, "dn cache: hits=%d misses=%d hit_rate=%.2f%%\n", hits, misses, float64(hits)/float64(hits+misses)*100)
+	}
+
+	if retired := m.Retired.Load(); retired > 0 {
+		fmt.Fprintf(w, "connections retired: %d\n", retired)
+	}
+
 	// Total latency stats for the whole run
 	tlat := m.Lat.TotalSnapshot()
 	if tlat.Count > 0 {
-		fmt.Fprintf(w, "latency (overall): count=%d avg_ms=%.2f p50_ms=%.2f p95_ms=%.2f p99_ms=%.2f\n",
-			tlat.Count,
-			float64(tlat.Avg.Microseconds())/1000.0,
-			float64(tlat.P50.Microseconds())/1000.0,
-			float64(tlat.P95.Microseconds())/1000.0,
-			float64(tlat.P99.Microseconds())/1000.0,
-		)
+		fmt.Fprintf(w, "latency (overall): count=%d avg_ms=%.2f min_ms=%.2f p50_ms=%.2f p95_ms=%.2f p99_ms=%.2f p99.9_ms=%.2f p99.99_ms=%.2f max_ms=%.2f\n",
+			tlat.Count, ms(tlat.Avg), ms(tlat.Min), ms(tlat.P50), ms(tlat.P95), ms(tlat.P99), ms(tlat.P999), ms(tlat.P9999), ms(tlat.Max))
 	}
+
+	printErrors(w, m.Errors())
+
+	// Per-stage breakdown of a load profile
+	for _, st := range m.Stages() {
+		el := st.Elapsed()
+		slat := st.Lat.TotalSnapshot()
+		fmt.Fprintf(w, "stage %s: elapsed=%v attempts=%d success=%d fail=%d rps=%.2f avg_ms=%.2f p50_ms=%.2f p95_ms=%.2f p99_ms=%.2f p99.9_ms=%.2f max_ms=%.2f\n",
+			st.Name, el.Truncate(time.Millisecond), st.Attempts.Load(), st.Success.Load(), st.Fail.Load(), perSecond(st.Success.Load(), el),
+			ms(slat.Avg), ms(slat.P50), ms(slat.P95), ms(slat.P99), ms(slat.P999), ms(slat.Max))
+	}
+
+	// Per-phase breakdown (dial, tls, lookup, bind, search, unbind)
+	for _, name := range m.PhaseNames() {
+		pm := m.Phase(name)
+		plat := pm.Lat.TotalSnapshot()
+		fmt.Fprintf(w, "phase %s: count=%d fail=%d rps=%.2f avg_ms=%.2f p50_ms=%.2f p95_ms=%.2f p99_ms=%.2f p99.9_ms=%.2f max_ms=%.2f\n",
+			name, pm.Attempts.Load(), pm.Fail.Load(), perSecond(pm.Success.Load(), elapsed), ms(plat.Avg), ms(plat.P50), ms(plat.P95), ms(plat.P99), ms(plat.P999), ms(plat.Max))
+	}
+
+	// Per-operation breakdown (bind, search, compare, ...)
+	for _, name := range m.OpNames() {
+		om := m.Op(name)
+		osuc := om.Success.Load()
+
+		var orps float64
+		if elapsed > 0 {
+			orps = float64(osuc) / elapsed.Seconds()
+		}
+
+		olat := om.Lat.TotalSnapshot()
+		fmt.Fprintf(w, "op %s: attempts=%d success=%d fail=%d rps=%.2f avg_ms=%.2f p50_ms=%.2f p95_ms=%.2f p99_ms=%.2f p99.9_ms=%.2f max_ms=%.2f\n",
+			name, om.Attempts.Load(), osuc, om.Fail.Load(), orps, ms(olat.Avg), ms(olat.P50), ms(olat.P95), ms(olat.P99), ms(olat.P999), ms(olat.Max))
+	}
+
+	// Per-server breakdown of the requests sent to each LDAP server
+	for _, name := range m.ServerNames() {
+		sm := m.Server(name)
+		slat := sm.Lat.TotalSnapshot()
+		fmt.Fprintf(w, "server %s: requests=%d success=%d fail=%d rps=%.2f avg_ms=%.2f p50_ms=%.2f p95_ms=%.2f p99_ms=%.2f p99.9_ms=%.2f max_ms=%.2f\n",
+			name, sm.Attempts.Load(), sm.Success.Load(), sm.Fail.Load(), perSecond(sm.Success.Load(), elapsed), ms(slat.Avg), ms(slat.P50), ms(slat.P95), ms(slat.P99), ms(slat.P999), ms(slat.Max))
+	}
+}
+
+// warmupElapsed returns the duration of the warm-up phase, or how long it has
+// been running.
+func warmupElapsed(m *metrics.Metrics) time.Duration {
+	wm := m.Warmup()
+	if wm == nil {
+		return 0
+	}
+
+	if end := m.WarmupEnd(); !end.IsZero() {
+		return end.Sub(wm.Start)
+	}
+
+	return time.Since(wm.Start)
+}
+
+// PrintSaturation writes the levels of a saturation search ordered by rate
+// and the highest rate that met the SLO.
+func PrintSaturation(w io.Writer, res *saturate.Result) {
+	fmt.Fprintf(w, "\n==== Saturation (%s) ====\n", res.Search)
+	fmt.Fprintf(w, "slo: %s\n", res.SLO)
+
+	for _, l := range res.Curve() {
+		verdict := "pass"
+		if !l.Pass {
+			verdict = "fail (" + l.Reason + ")"
+		}
+
+		fmt.Fprintf(w, "level %s: rate=%g achieved=%.2f p99_ms=%.2f error_rate=%.2f%% %s\n", l.Name, l.Rate, l.Achieved, ms(l.P99), l.ErrorRate, verdict)
+	}
+
+	if res.Max == nil {
+		fmt.Fprintf(w, "max rate: none of %d tested levels met the SLO\n", len(res.Levels))
+
+		return
+	}
+
+	fmt.Fprintf(w, "max rate: %g/s (%s)\n", res.Max.Rate, res.Max.Name)
 }
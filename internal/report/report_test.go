@@ -2,11 +2,17 @@ package report
 
 import (
 	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/croessner/ldapbench/internal/config"
 	"github.com/croessner/ldapbench/internal/metrics"
+	"github.com/croessner/ldapbench/internal/saturate"
 )
 
 func TestPrintSummary(t *testing.T) {
@@ -14,14 +20,267 @@ func TestPrintSummary(t *testing.T) {
 	m.Attempts.Add(10)
 	m.Success.Add(7)
 	m.Fail.Add(3)
+	m.Op("bind").Record(time.Millisecond, nil)
+	m.Phase(metrics.PhaseLookup).Record(time.Millisecond, nil)
+	m.CountError("busy")
+	m.CountError("busy")
+	m.CountError("timeout")
+	m.BeginStage("ramp").Record(time.Millisecond, nil)
+	m.EndStage()
+	m.Server("ldap://a:389").Record(time.Millisecond, nil)
+	m.Failovers.Add(2)
+	m.Reconnects.Add(1)
+	m.ReconnectFailures.Add(4)
+	m.DNCacheHits.Add(3)
+	m.DNCacheMisses.Add(1)
+	m.Retired.Add(6)
+	m.Negative.Add(3)
+	m.ExpectedFail.Add(2)
+	m.UnexpectedSuccess.Add(1)
 
 	var buf bytes.Buffer
 	PrintSummary(&buf, m, 2*time.Second)
 	out := buf.String()
 
-	for _, want := range []string{"Summary", "attempts: 10", "success: 7", "fail: 3", "avg rps"} {
+	for _, want := range []string{"stage ramp: elapsed=", "Summary", "attempts: 10", "success: 7", "fail: 3", "avg rps", "op bind: attempts=1 success=1", "phase lookup: count=1 fail=0", "errors (top 2 of 2 classes):", "66.67%", "server ldap://a:389: requests=1 success=1 fail=0", "failovers: 2", "lookup reconnects: success=1 fail=4", "dn cache: hits=3 misses=1 hit_rate=75.00%", "connections retired: 6", "phase lookup: count=1 fail=0 rps=0.50", "negative cases: attempts=3 expected_failure=2 unexpected_success=1 unexpected_failure=0"} {
 		if !strings.Contains(out, want) {
 			t.Fatalf("summary missing %q in output: %s", want, out)
 		}
 	}
 }
+
+func TestWriteResult(t *testing.T) {
+	m := metrics.New()
+	m.Attempts.Add(4)
+	m.Success.Add(3)
+	m.Fail.Add(1)
+	m.Op("bind").Record(2*time.Millisecond, nil)
+	m.CountError("invalidCredentials")
+
+	meta := Meta{Version: "v1.2.3", Start: time.Unix(1700000000, 0), Elapsed: 2 * time.Second, Settings: map[string]string{"mode": "auth", "filter": "(|(uid=%s)(mail=%s))"}, Seed: 42}
+
+	var buf bytes.Buffer
+	if err := WriteResult(&buf, FormatJSON, m, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	var res Result
+	if err := json.Unmarshal(buf.Bytes(), &res); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+
+	if res.SchemaVersion != SchemaVersion || res.Run.Version != "v1.2.3" || res.Run.Seed != 42 || res.Totals.Attempts != 4 || res.Totals.RPS != 1.5 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	if len(res.Operations) != 1 || res.Operations[0].Name != "bind" || res.Operations[0].Latency.Count != 1 {
+		t.Fatalf("unexpected operations: %+v", res.Operations)
+	}
+
+	if len(res.Errors) != 1 || res.Errors[0].Count != 1 || res.Config["mode"] != "auth" {
+		t.Fatalf("unexpected errors/config: %+v %v", res.Errors, res.Config)
+	}
+
+	buf.Reset()
+	if err := WriteResult(&buf, FormatCSV, m, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid csv: %v", err)
+	}
+
+	values := make(map[string]string)
+	for _, r := range rows {
+		values[r[0]] = r[1]
+	}
+
+	if values["totals.success"] != "3" || values["operations.bind.attempts"] != "1" || values["errors.invalidCredentials"] != "1" || values["run.seed"] != "42" {
+		t.Fatalf("unexpected csv rows: %v", rows)
+	}
+
+	buf.Reset()
+	if err := WriteResult(&buf, FormatMarkdown, m, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := buf.String(); !strings.Contains(out, "| op bind | 1 |") || !strings.Contains(out, "| mode | `auth` |") || !strings.Contains(out, "| filter | `(\\|(uid=%s)(mail=%s))` |") {
+		t.Fatalf("unexpected markdown: %s", out)
+	}
+}
+
+func TestTakeSample(t *testing.T) {
+	m := metrics.New()
+	last := newCounters(m.Start)
+
+	m.Attempts.Add(10)
+	m.Success.Add(8)
+	m.Fail.Add(2)
+	m.Lat.Record(time.Millisecond)
+	m.Op("bind").Record(time.Millisecond, nil)
+	m.CountError("other")
+
+	s := takeSample(m, last, m.Start.Add(2*time.Second))
+	if s.RPS != 4 || s.ARPS != 5 || s.DeltaFail != 2 || s.Latency.Count != 1 {
+		t.Fatalf("unexpected sample: %+v", s)
+	}
+
+	if len(s.Operations) != 1 || s.Operations[0].DeltaSucc != 1 || len(s.Errors) != 1 || s.Errors[0].Delta != 1 {
+		t.Fatalf("unexpected breakdown: %+v %+v", s.Operations, s.Errors)
+	}
+
+	m.Attempts.Add(1)
+	m.Fail.Add(1)
+	m.CountError("other")
+	m.BeginStage("step2")
+	m.Late.Add(2)
+	m.Dropped.Add(1)
+
+	s = takeSample(m, last, m.Start.Add(3*time.Second))
+	if s.DeltaFail != 1 || s.Latency.Count != 0 || s.Errors[0].Count != 2 || s.Errors[0].Delta != 1 || s.Stage != "step2" || s.Late != 2 || s.Dropped != 1 {
+		t.Fatalf("deltas not relative to previous sample: %+v", s)
+	}
+
+	var buf bytes.Buffer
+	printSample(&buf, s)
+	if out := buf.String(); !strings.Contains(out, "[stats] elapsed=3s attempts=11") || !strings.Contains(out, "[stats] op=bind") || !strings.Contains(out, " late=2 dropped=1 stage=step2\n") {
+		t.Fatalf("unexpected stats lines: %s", out)
+	}
+}
+
+func TestSeries(t *testing.T) {
+	s := Sample{
+		Time:       time.Unix(1700000000, 0),
+		Attempts:   3,
+		Late:       4,
+		Dropped:    2,
+		Operations: []OpSample{{Name: "bind", Attempts: 3}},
+		Errors:     []ErrorSample{{Class: "other", Count: 1, Delta: 1}},
+	}
+
+	for _, format := range []string{SeriesJSONL, SeriesCSV} {
+		path := filepath.Join(t.TempDir(), "stats."+format)
+
+		series, err := NewSeries(path, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for range 2 {
+			if err := series.Write(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := series.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		switch format {
+		case SeriesJSONL:
+			var got Sample
+			if len(lines) != 2 || json.Unmarshal([]byte(lines[0]), &got) != nil || got.Operations[0].Name != "bind" || got.Late != 4 || got.Dropped != 2 {
+				t.Fatalf("unexpected jsonl: %s", data)
+			}
+		case SeriesCSV:
+			// header plus total, op and error rows per sample
+			if len(lines) != 7 || !strings.HasPrefix(lines[0], "time,elapsed_s,scope") || !strings.HasSuffix(lines[1], ",4,2,,false") || !strings.Contains(lines[2], ",op,bind,3,") {
+				t.Fatalf("unexpected csv: %s", data)
+			}
+		}
+	}
+
+	if _, err := NewSeries(filepath.Join(t.TempDir(), "x"), "xml"); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestSaturationOutput(t *testing.T) {
+	pass := saturate.Level{Name: "rate100", Rate: 100, Achieved: 99.5, P99: 4 * time.Millisecond, Pass: true}
+	sat := &saturate.Result{
+		Search: config.SearchLinear,
+		SLO:    config.SLO{P99: 5 * time.Millisecond},
+		Levels: []saturate.Level{
+			{Name: "rate200", Rate: 200, Achieved: 198, P99: 9 * time.Millisecond, Reason: "p99 9ms > 5ms"},
+			pass,
+		},
+		Max: &pass,
+	}
+	meta := Meta{Version: "dev", Start: time.Unix(1700000000, 0), Elapsed: time.Second, Saturation: sat}
+
+	var buf bytes.Buffer
+	if err := WriteResult(&buf, FormatText, metrics.New(), meta); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"==== Saturation (linear) ====", "slo: p99<=5ms", "level rate100: rate=100", "fail (p99 9ms > 5ms)", "max rate: 100/s (rate100)"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("saturation output missing %q: %s", want, out)
+		}
+	}
+
+	if strings.Index(out, "level rate100") > strings.Index(out, "level rate200") {
+		t.Fatalf("levels not ordered by rate: %s", out)
+	}
+
+	buf.Reset()
+	if err := WriteResult(&buf, FormatJSON, metrics.New(), meta); err != nil {
+		t.Fatal(err)
+	}
+
+	var res Result
+	if err := json.Unmarshal(buf.Bytes(), &res); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+
+	if s := res.Saturation; s == nil || !s.Found || s.MaxRate != 100 || len(s.Levels) != 2 || s.Levels[1].Pass {
+		t.Fatalf("unexpected saturation result: %+v", res.Saturation)
+	}
+}
+
+func TestWarmupReporting(t *testing.T) {
+	m := metrics.New()
+	w := m.BeginWarmup()
+	cur, last := switchBucket(m, m, newCounters(time.Now().Add(-time.Minute)))
+	if cur != w {
+		t.Fatal("expected the reporter to follow the warm-up bucket")
+	}
+
+	w.Attempts.Add(5)
+	w.Success.Add(5)
+	m.EndWarmup()
+	m.Attempts.Add(2)
+	m.Success.Add(2)
+
+	// The first measured interval starts at the end of the warm-up, not at
+	// the last warm-up tick a minute earlier.
+	cur, last = switchBucket(m, cur, last)
+	if s := takeSample(cur, last, m.WarmupEnd().Add(time.Second)); cur != m || s.ARPS != 2 || s.RPS != 2 {
+		t.Fatalf("first measured interval: arps=%v rps=%v, want 2", s.ARPS, s.RPS)
+	}
+
+	var buf bytes.Buffer
+	printSample(&buf, Sample{Warmup: true, Operations: []OpSample{{Name: "bind"}}})
+	if out := buf.String(); !strings.HasPrefix(out, "[warmup] elapsed=") || !strings.Contains(out, "[warmup] op=bind") {
+		t.Fatalf("warm-up sample not tagged: %s", out)
+	}
+
+	buf.Reset()
+	PrintSummary(&buf, m, time.Second)
+	if out := buf.String(); !strings.Contains(out, "attempts: 2\n") || !strings.Contains(out, "warmup (excluded): elapsed=") || !strings.Contains(out, "attempts=5 success=5") {
+		t.Fatalf("unexpected summary: %s", out)
+	}
+
+	res := NewResult(m, Meta{Elapsed: time.Second})
+	if res.Warmup == nil || res.Warmup.Attempts != 5 || res.Totals.Attempts != 2 {
+		t.Fatalf("unexpected result: %+v %+v", res.Warmup, res.Totals)
+	}
+}
@@ -0,0 +1,544 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/croessner/ldapbench/internal/metrics"
+	"github.com/croessner/ldapbench/internal/saturate"
+)
+
+// SchemaVersion is the version of the Result document. It is incremented on
+// incompatible changes to the field layout.
+const SchemaVersion = 1
+
+// Output formats of the final summary.
+const (
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+)
+
+// Meta describes the run for the result document.
+type Meta struct {
+	Version  string // tool version
+	Start    time.Time
+	Elapsed  time.Duration
+	Settings map[string]string // effective flags, secrets redacted
+	Seed     uint64            // seed of all randomness; 0 if unknown
+
+	// Saturation is the outcome of --find-max; nil for normal runs.
+	Saturation *saturate.Result
+}
+
+// Result is the machine-readable summary of a run.
+type Result struct {
+	SchemaVersion int               `json:"schema_version"`
+	Run           RunInfo           `json:"run"`
+	Config        map[string]string `json:"config"`
+	Totals        Totals            `json:"totals"`
+	Latency       Latency           `json:"latency"`
+	Phases        []OpResult        `json:"phases"`
+	Operations    []OpResult        `json:"operations"`
+	Servers       []OpResult        `json:"servers"`
+	Stages        []StageResult     `json:"stages"`
+	Errors        []ErrorResult     `json:"errors"`
+	Warmup        *WarmupResult     `json:"warmup,omitempty"`
+	Saturation    *SaturationResult `json:"saturation,omitempty"`
+}
+
+// RunInfo holds the run metadata.
+type RunInfo struct {
+	Tool           string    `json:"tool"`
+	Version        string    `json:"version"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	ElapsedSeconds float64   `json:"elapsed_seconds"`
+	Host           string    `json:"host"`
+	GoVersion      string    `json:"go_version"`
+	OS             string    `json:"os"`
+	Arch           string    `json:"arch"`
+	Seed           uint64    `json:"seed"`
+}
+
+// Totals holds the overall counters.
+type Totals struct {
+	Attempts       int64   `json:"attempts"`
+	Success        int64   `json:"success"`
+	Fail           int64   `json:"fail"`
+	SuccessRate    float64 `json:"success_rate"` // percent
+	RPS            float64 `json:"rps"`          // successful requests per second
+	CompareTrue    int64   `json:"compare_true"`
+	CompareFalse   int64   `json:"compare_false"`
+	PolicyFailures int64   `json:"policy_failures"`
+	Late           int64   `json:"late"`    // open loop: iterations started late
+	Dropped        int64   `json:"dropped"` // open loop: schedules dropped
+	Failovers      int64   `json:"failovers"`
+
+	// Lookup connections re-established after they broke.
+	Reconnects        int64 `json:"reconnects"`
+	ReconnectFailures int64 `json:"reconnect_failures"`
+
+	// DN lookups answered from the DN cache and those that had to search.
+	DNCacheHits   int64 `json:"dn_cache_hits"`
+	DNCacheMisses int64 `json:"dn_cache_misses"`
+
+	// User connections retired by the connection policy.
+	Retired int64 `json:"retired_connections"`
+
+	// Negative test cases (CSV rows with expected_ok=false).
+	Negative          int64 `json:"negative"`
+	ExpectedFail      int64 `json:"expected_failure"`
+	UnexpectedSuccess int64 `json:"unexpected_success"`
+	UnexpectedFail    int64 `json:"unexpected_failure"`
+}
+
+// Latency holds latency statistics in milliseconds.
+type Latency struct {
+	Count   int64   `json:"count"`
+	AvgMs   float64 `json:"avg_ms"`
+	MinMs   float64 `json:"min_ms"`
+	P50Ms   float64 `json:"p50_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+	P99Ms   float64 `json:"p99_ms"`
+	P999Ms  float64 `json:"p99.9_ms"`
+	P9999Ms float64 `json:"p99.99_ms"`
+	MaxMs   float64 `json:"max_ms"`
+}
+
+// OpResult holds the counters and latencies of one operation or phase.
+type OpResult struct {
+	Name     string  `json:"name"`
+	Attempts int64   `json:"attempts"`
+	Success  int64   `json:"success"`
+	Fail     int64   `json:"fail"`
+	RPS      float64 `json:"rps"`
+	Latency  Latency `json:"latency"`
+}
+
+// StageResult holds the counters and latencies of one stage of a load
+// profile. RPS refers to the stage's own elapsed time.
+type StageResult struct {
+	OpResult
+
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// WarmupResult holds the counters of the warm-up phase, which are not
+// included anywhere else in the result.
+type WarmupResult struct {
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	Attempts       int64   `json:"attempts"`
+	Success        int64   `json:"success"`
+	Fail           int64   `json:"fail"`
+}
+
+// SaturationResult is the outcome of a saturation search. The latencies of
+// every level are listed under Stages by the level's name.
+type SaturationResult struct {
+	Search  string        `json:"search"`
+	SLO     string        `json:"slo"`
+	Found   bool          `json:"found"`
+	MaxRate float64       `json:"max_rate"` // highest passing rate; 0 if none passed
+	Levels  []LevelResult `json:"levels"`   // ordered by rate
+}
+
+// LevelResult is the verdict of one tested rate.
+type LevelResult struct {
+	Name      string  `json:"name"`
+	Rate      float64 `json:"rate"`
+	Achieved  float64 `json:"achieved_rps"`
+	P99Ms     float64 `json:"p99_ms"`
+	ErrorRate float64 `json:"error_rate"` // percent
+	Pass      bool    `json:"pass"`
+	Reason    string  `json:"reason,omitempty"`
+}
+
+// ErrorResult is the failure count of one error class.
+type ErrorResult struct {
+	Class string `json:"class"`
+	Count int64  `json:"count"`
+}
+
+// NewResult builds the result document from the final metrics.
+func NewResult(m *metrics.Metrics, meta Meta) *Result {
+	host, _ := os.Hostname()
+
+	res := &Result{
+		SchemaVersion: SchemaVersion,
+		Run: RunInfo{
+			Tool:           "ldapbench",
+			Version:        meta.Version,
+			Start:          meta.Start,
+			End:            meta.Start.Add(meta.Elapsed),
+			ElapsedSeconds: meta.Elapsed.Seconds(),
+			Host:           host,
+			GoVersion:      runtime.Version(),
+			OS:             runtime.GOOS,
+			Arch:           runtime.GOARCH,
+			Seed:           meta.Seed,
+		},
+		Config: meta.Settings,
+		Totals: Totals{
+			Attempts:       m.Attempts.Load(),
+			Success:        m.Success.Load(),
+			Fail:           m.Fail.Load(),
+			RPS:            perSecond(m.Success.Load(), meta.Elapsed),
+			CompareTrue:    m.CompareTrue.Load(),
+			CompareFalse:   m.CompareFalse.Load(),
+			PolicyFailures: m.PolicyFail.Load(),
+			Late:           m.Late.Load(),
+			Dropped:        m.Dropped.Load(),
+			Failovers:      m.Failovers.Load(),
+
+			Reconnects:        m.Reconnects.Load(),
+			ReconnectFailures: m.ReconnectFailures.Load(),
+
+			DNCacheHits:   m.DNCacheHits.Load(),
+			DNCacheMisses: m.DNCacheMisses.Load(),
+
+			Retired: m.Retired.Load(),
+
+			Negative:          m.Negative.Load(),
+			ExpectedFail:      m.ExpectedFail.Load(),
+			UnexpectedSuccess: m.UnexpectedSuccess.Load(),
+			UnexpectedFail:    m.UnexpectedFail.Load(),
+		},
+		Latency:    latency(m.Lat.TotalSnapshot()),
+		Phases:     []OpResult{},
+		Operations: []OpResult{},
+		Servers:    []OpResult{},
+		Stages:     []StageResult{},
+		Errors:     []ErrorResult{},
+	}
+
+	if wm := m.Warmup(); wm != nil {
+		res.Warmup = &WarmupResult{ElapsedSeconds: warmupElapsed(m).Seconds(), Attempts: wm.Attempts.Load(), Success: wm.Success.Load(), Fail: wm.Fail.Load()}
+	}
+
+	if sat := meta.Saturation; sat != nil {
+		res.Saturation = &SaturationResult{Search: string(sat.Search), SLO: sat.SLO.String(), Levels: []LevelResult{}}
+		if sat.Max != nil {
+			res.Saturation.Found, res.Saturation.MaxRate = true, sat.Max.Rate
+		}
+
+		for _, l := range sat.Curve() {
+			res.Saturation.Levels = append(res.Saturation.Levels, LevelResult{
+				Name: l.Name, Rate: l.Rate, Achieved: l.Achieved, P99Ms: ms(l.P99), ErrorRate: l.ErrorRate, Pass: l.Pass, Reason: l.Reason,
+			})
+		}
+	}
+
+	if res.Totals.Attempts > 0 {
+		res.Totals.SuccessRate = float64(res.Totals.Success) * 100 / float64(res.Totals.Attempts)
+	}
+
+	for _, name := range m.PhaseNames() {
+		res.Phases = append(res.Phases, opResult(name, m.Phase(name), meta.Elapsed))
+	}
+
+	for _, name := range m.OpNames() {
+		res.Operations = append(res.Operations, opResult(name, m.Op(name), meta.Elapsed))
+	}
+
+	for _, name := range m.ServerNames() {
+		res.Servers = append(res.Servers, opResult(name, m.Server(name), meta.Elapsed))
+	}
+
+	for _, st := range m.Stages() {
+		res.Stages = append(res.Stages, StageResult{OpResult: opResult(st.Name, &st.OpMetrics, st.Elapsed()), ElapsedSeconds: st.Elapsed().Seconds()})
+	}
+
+	for _, e := range m.Errors() {
+		res.Errors = append(res.Errors, ErrorResult{Class: e.Class, Count: e.Count})
+	}
+
+	return res
+}
+
+func opResult(name string, om *metrics.OpMetrics, elapsed time.Duration) OpResult {
+	return OpResult{
+		Name:     name,
+		Attempts: om.Attempts.Load(),
+		Success:  om.Success.Load(),
+		Fail:     om.Fail.Load(),
+		RPS:      perSecond(om.Success.Load(), elapsed),
+		Latency:  latency(om.Lat.TotalSnapshot()),
+	}
+}
+
+func latency(s metrics.LatencyStats) Latency {
+	return Latency{
+		Count:   s.Count,
+		AvgMs:   ms(s.Avg),
+		MinMs:   ms(s.Min),
+		P50Ms:   ms(s.P50),
+		P95Ms:   ms(s.P95),
+		P99Ms:   ms(s.P99),
+		P999Ms:  ms(s.P999),
+		P9999Ms: ms(s.P9999),
+		MaxMs:   ms(s.Max),
+	}
+}
+
+func perSecond(n int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(n) / elapsed.Seconds()
+}
+
+// WriteResult writes the summary of m in format (text|json|csv|markdown).
+func WriteResult(w io.Writer, format string, m *metrics.Metrics, meta Meta) error {
+	if format == FormatText || format == "" {
+		PrintSummary(w, m, meta.Elapsed)
+		if meta.Seed != 0 {
+			fmt.Fprintf(w, "seed: %d\n", meta.Seed)
+		}
+
+		if meta.Saturation != nil {
+			PrintSaturation(w, meta.Saturation)
+		}
+
+		return nil
+	}
+
+	res := NewResult(m, meta)
+
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(res)
+	case FormatCSV:
+		return res.writeCSV(w)
+	case FormatMarkdown:
+		return res.writeMarkdown(w)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// writeCSV writes the result as key,value rows with dotted keys, e.g.
+// "operations.bind.latency.p99_ms".
+func (r *Result) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	row := func(key string, value any) {
+		_ = cw.Write([]string{key, fmt.Sprint(value)})
+	}
+
+	row("key", "value")
+	row("schema_version", r.SchemaVersion)
+	row("run.tool", r.Run.Tool)
+	row("run.version", r.Run.Version)
+	row("run.start", r.Run.Start.Format(time.RFC3339Nano))
+	row("run.end", r.Run.End.Format(time.RFC3339Nano))
+	row("run.elapsed_seconds", fmtFloat(r.Run.ElapsedSeconds))
+	row("run.host", r.Run.Host)
+	row("run.go_version", r.Run.GoVersion)
+	row("run.os", r.Run.OS)
+	row("run.arch", r.Run.Arch)
+	row("run.seed", r.Run.Seed)
+
+	for _, k := range sortedKeys(r.Config) {
+		row("config."+k, r.Config[k])
+	}
+
+	row("totals.attempts", r.Totals.Attempts)
+	row("totals.success", r.Totals.Success)
+	row("totals.fail", r.Totals.Fail)
+	row("totals.success_rate", fmtFloat(r.Totals.SuccessRate))
+	row("totals.rps", fmtFloat(r.Totals.RPS))
+	row("totals.compare_true", r.Totals.CompareTrue)
+	row("totals.compare_false", r.Totals.CompareFalse)
+	row("totals.policy_failures", r.Totals.PolicyFailures)
+	row("totals.late", r.Totals.Late)
+	row("totals.dropped", r.Totals.Dropped)
+	row("totals.failovers", r.Totals.Failovers)
+	row("totals.reconnects", r.Totals.Reconnects)
+	row("totals.reconnect_failures", r.Totals.ReconnectFailures)
+	row("totals.dn_cache_hits", r.Totals.DNCacheHits)
+	row("totals.dn_cache_misses", r.Totals.DNCacheMisses)
+	row("totals.retired_connections", r.Totals.Retired)
+	row("totals.negative", r.Totals.Negative)
+	row("totals.expected_failure", r.Totals.ExpectedFail)
+	row("totals.unexpected_success", r.Totals.UnexpectedSuccess)
+	row("totals.unexpected_failure", r.Totals.UnexpectedFail)
+
+	latencyRows := func(prefix string, l Latency) {
+		row(prefix+"count", l.Count)
+		row(prefix+"avg_ms", fmtFloat(l.AvgMs))
+		row(prefix+"min_ms", fmtFloat(l.MinMs))
+		row(prefix+"p50_ms", fmtFloat(l.P50Ms))
+		row(prefix+"p95_ms", fmtFloat(l.P95Ms))
+		row(prefix+"p99_ms", fmtFloat(l.P99Ms))
+		row(prefix+"p99.9_ms", fmtFloat(l.P999Ms))
+		row(prefix+"p99.99_ms", fmtFloat(l.P9999Ms))
+		row(prefix+"max_ms", fmtFloat(l.MaxMs))
+	}
+
+	latencyRows("latency.", r.Latency)
+
+	for _, s := range []struct {
+		name string
+		list []OpResult
+	}{{"phases", r.Phases}, {"operations", r.Operations}, {"servers", r.Servers}} {
+		for _, o := range s.list {
+			prefix := s.name + "." + o.Name + "."
+			row(prefix+"attempts", o.Attempts)
+			row(prefix+"success", o.Success)
+			row(prefix+"fail", o.Fail)
+			row(prefix+"rps", fmtFloat(o.RPS))
+			latencyRows(prefix+"latency.", o.Latency)
+		}
+	}
+
+	for _, st := range r.Stages {
+		prefix := "stages." + st.Name + "."
+		row(prefix+"elapsed_seconds", fmtFloat(st.ElapsedSeconds))
+		row(prefix+"attempts", st.Attempts)
+		row(prefix+"success", st.Success)
+		row(prefix+"fail", st.Fail)
+		row(prefix+"rps", fmtFloat(st.RPS))
+		latencyRows(prefix+"latency.", st.Latency)
+	}
+
+	for _, e := range r.Errors {
+		row("errors."+e.Class, e.Count)
+	}
+
+	if wu := r.Warmup; wu != nil {
+		row("warmup.elapsed_seconds", fmtFloat(wu.ElapsedSeconds))
+		row("warmup.attempts", wu.Attempts)
+		row("warmup.success", wu.Success)
+		row("warmup.fail", wu.Fail)
+	}
+
+	if sat := r.Saturation; sat != nil {
+		row("saturation.search", sat.Search)
+		row("saturation.slo", sat.SLO)
+		row("saturation.found", sat.Found)
+		row("saturation.max_rate", fmtFloat(sat.MaxRate))
+		for _, l := range sat.Levels {
+			prefix := "saturation.levels." + l.Name + "."
+			row(prefix+"rate", fmtFloat(l.Rate))
+			row(prefix+"achieved_rps", fmtFloat(l.Achieved))
+			row(prefix+"p99_ms", fmtFloat(l.P99Ms))
+			row(prefix+"error_rate", fmtFloat(l.ErrorRate))
+			row(prefix+"pass", l.Pass)
+			row(prefix+"reason", l.Reason)
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// writeMarkdown writes the result as Markdown tables.
+func (r *Result) writeMarkdown(w io.Writer) error {
+	fmt.Fprintf(w, "# ldapbench results\n\n")
+	fmt.Fprintf(w, "| Run | |\n|---|---|\n")
+	fmt.Fprintf(w, "| version | %s |\n", r.Run.Version)
+	fmt.Fprintf(w, "| start | %s |\n", r.Run.Start.Format(time.RFC3339))
+	fmt.Fprintf(w, "| elapsed | %.2fs |\n", r.Run.ElapsedSeconds)
+	fmt.Fprintf(w, "| host | %s |\n", r.Run.Host)
+	fmt.Fprintf(w, "| go | %s %s/%s |\n", r.Run.GoVersion, r.Run.OS, r.Run.Arch)
+	fmt.Fprintf(w, "| seed | %d |\n\n", r.Run.Seed)
+
+	fmt.Fprintf(w, "## Totals\n\n| attempts | success | fail | success rate | rps |\n|---:|---:|---:|---:|---:|\n")
+	fmt.Fprintf(w, "| %d | %d | %d | %.2f%% | %.2f |\n\n", r.Totals.Attempts, r.Totals.Success, r.Totals.Fail, r.Totals.SuccessRate, r.Totals.RPS)
+
+	if t := r.Totals; t.Negative > 0 {
+		fmt.Fprintf(w, "Negative test cases: %d attempts, %d expected failures, %d unexpected successes, %d unexpected failures.\n\n",
+			t.Negative, t.ExpectedFail, t.UnexpectedSuccess, t.UnexpectedFail)
+	}
+
+	if wu := r.Warmup; wu != nil {
+		fmt.Fprintf(w, "Excluded warm-up: %.2fs, %d attempts (%d success, %d fail).\n\n", wu.ElapsedSeconds, wu.Attempts, wu.Success, wu.Fail)
+	}
+
+	fmt.Fprintf(w, "## Latency (ms)\n\n| scope | count | fail | rps | avg | p50 | p95 | p99 | p99.9 | p99.99 | max |\n|---|---:|---:|---:|---:|---:|---:|---:|---:|---:|---:|\n")
+	latencyRow := func(scope string, fail int64, rps float64, l Latency) {
+		fmt.Fprintf(w, "| %s | %d | %d | %.2f | %.2f | %.2f | %.2f | %.2f | %.2f | %.2f | %.2f |\n",
+			scope, l.Count, fail, rps, l.AvgMs, l.P50Ms, l.P95Ms, l.P99Ms, l.P999Ms, l.P9999Ms, l.MaxMs)
+	}
+
+	latencyRow("overall", r.Totals.Fail, r.Totals.RPS, r.Latency)
+	for _, o := range r.Operations {
+		latencyRow("op "+o.Name, o.Fail, o.RPS, o.Latency)
+	}
+
+	for _, p := range r.Phases {
+		latencyRow("phase "+p.Name, p.Fail, p.RPS, p.Latency)
+	}
+
+	for _, st := range r.Stages {
+		latencyRow("stage "+st.Name, st.Fail, st.RPS, st.Latency)
+	}
+
+	for _, s := range r.Servers {
+		latencyRow("server "+s.Name, s.Fail, s.RPS, s.Latency)
+	}
+
+	if len(r.Errors) > 0 {
+		fmt.Fprintf(w, "\n## Errors\n\n| class | count |\n|---|---:|\n")
+		for _, e := range r.Errors {
+			fmt.Fprintf(w, "| %s | %d |\n", e.Class, e.Count)
+		}
+	}
+
+	if sat := r.Saturation; sat != nil {
+		fmt.Fprintf(w, "\n## Saturation (%s, SLO %s)\n\n", sat.Search, sat.SLO)
+		if sat.Found {
+			fmt.Fprintf(w, "Highest passing rate: **%g/s**\n\n", sat.MaxRate)
+		} else {
+			fmt.Fprintf(w, "No tested rate met the SLO.\n\n")
+		}
+
+		fmt.Fprintf(w, "| rate | achieved | p99 (ms) | error rate | result |\n|---:|---:|---:|---:|---|\n")
+		for _, l := range sat.Levels {
+			verdict := "pass"
+			if !l.Pass {
+				verdict = "fail: " + l.Reason
+			}
+
+			fmt.Fprintf(w, "| %g | %.2f | %.2f | %.2f%% | %s |\n", l.Rate, l.Achieved, l.P99Ms, l.ErrorRate, verdict)
+		}
+	}
+
+	fmt.Fprintf(w, "\n## Config\n\n| flag | value |\n|---|---|\n")
+	for _, k := range sortedKeys(r.Config) {
+		fmt.Fprintf(w, "| %s | `%s` |\n", escapeCell(k), escapeCell(r.Config[k]))
+	}
+
+	return nil
+}
+
+// escapeCell escapes the pipes in s, which would otherwise split a Markdown
+// table cell, e.g. in the filter (|(uid=%s)(mail=%s)).
+func escapeCell(s string) string { return strings.ReplaceAll(s, "|", `\|`) }
+
+func fmtFloat(f float64) string { return strconv.FormatFloat(f, 'f', 3, 64) }
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
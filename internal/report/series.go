@@ -0,0 +1,186 @@
+package report
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Time-series formats.
+const (
+	SeriesJSONL = "jsonl"
+	SeriesCSV   = "csv"
+)
+
+// Sample is one reporting interval. Counters are cumulative; rates, deltas
+// and latencies cover the interval only.
+type Sample struct {
+	Time          time.Time     `json:"time"`
+	Elapsed       float64       `json:"elapsed_seconds"`
+	Stage         string        `json:"stage,omitempty"`  // stage of the load profile at the end of the interval
+	Warmup        bool          `json:"warmup,omitempty"` // interval of the warm-up phase, excluded from the summary
+	Attempts      int64         `json:"attempts"`
+	Success       int64         `json:"success"`
+	Fail          int64         `json:"fail"`
+	Late          int64         `json:"late"`
+	Dropped       int64         `json:"dropped"`
+	RPS           float64       `json:"rps"`
+	ARPS          float64       `json:"arps"`
+	SuccessRate   float64       `json:"srate"`
+	IntervalSRate float64       `json:"israte"`
+	DeltaSucc     int64         `json:"ds"`
+	DeltaFail     int64         `json:"df"`
+	Latency       Latency       `json:"latency"`
+	Phases        []PhaseSample `json:"phases"`
+	Operations    []OpSample    `json:"operations"`
+	Errors        []ErrorSample `json:"errors"`
+}
+
+// PhaseSample is the interval latency of one phase.
+type PhaseSample struct {
+	Name    string  `json:"name"`
+	Latency Latency `json:"latency"`
+}
+
+// OpSample is the interval sample of one operation.
+type OpSample struct {
+	Name      string  `json:"name"`
+	Attempts  int64   `json:"attempts"`
+	Success   int64   `json:"success"`
+	Fail      int64   `json:"fail"`
+	RPS       float64 `json:"rps"`
+	DeltaSucc int64   `json:"ds"`
+	DeltaFail int64   `json:"df"`
+	Latency   Latency `json:"latency"`
+}
+
+// ErrorSample is the failure count of one error class: Count since start and
+// Delta in the interval.
+type ErrorSample struct {
+	Class string `json:"class"`
+	Count int64  `json:"count"`
+	Delta int64  `json:"delta"`
+}
+
+// seriesHeader is the CSV header. Every sample becomes one "total" row plus
+// one row per phase, operation and error class; fields that do not apply to
+// a scope are left empty.
+var seriesHeader = []string{
+	"time", "elapsed_s", "scope", "name",
+	"attempts", "success", "fail", "rps", "arps", "srate", "israte", "ds", "df",
+	"count", "avg_ms", "p50_ms", "p95_ms", "p99_ms", "max_ms",
+	"late", "dropped", "stage", "warmup",
+}
+
+// Series writes interval samples to a file as JSON lines or CSV.
+type Series struct {
+	mu     sync.Mutex
+	f      *os.File
+	w      *bufio.Writer
+	csv    *csv.Writer
+	format string
+}
+
+// NewSeries creates the file at path and writes samples in format (jsonl|csv).
+func NewSeries(path, format string) (*Series, error) {
+	if format != SeriesJSONL && format != SeriesCSV {
+		return nil, fmt.Errorf("unknown stats format %q", format)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create stats file: %w", err)
+	}
+
+	s := &Series{f: f, w: bufio.NewWriter(f), format: format}
+	if format == SeriesCSV {
+		s.csv = csv.NewWriter(s.w)
+		if err := s.csv.Write(seriesHeader); err != nil {
+			_ = f.Close()
+
+			return nil, fmt.Errorf("write stats header: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// Write appends one sample and flushes it so the file can be followed live.
+func (s *Series) Write(sample Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.csv != nil {
+		for _, row := range sampleRows(sample) {
+			if err := s.csv.Write(row); err != nil {
+				return err
+			}
+		}
+
+		s.csv.Flush()
+		if err := s.csv.Error(); err != nil {
+			return err
+		}
+	} else {
+		b, err := json.Marshal(sample)
+		if err != nil {
+			return err
+		}
+
+		b = append(b, '\n')
+		if _, err := s.w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return s.w.Flush()
+}
+
+// Close flushes and closes the file.
+func (s *Series) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.w.Flush(); err != nil {
+		_ = s.f.Close()
+
+		return err
+	}
+
+	return s.f.Close()
+}
+
+// sampleRows flattens a sample into CSV rows matching seriesHeader.
+func sampleRows(s Sample) [][]string {
+	ts := s.Time.Format(time.RFC3339Nano)
+	el := fmtFloat(s.Elapsed)
+	i := func(v int64) string { return strconv.FormatInt(v, 10) }
+	lat := func(l Latency) []string {
+		return []string{i(l.Count), fmtFloat(l.AvgMs), fmtFloat(l.P50Ms), fmtFloat(l.P95Ms), fmtFloat(l.P99Ms), fmtFloat(l.MaxMs)}
+	}
+
+	rows := [][]string{append([]string{ts, el, "total", "",
+		i(s.Attempts), i(s.Success), i(s.Fail), fmtFloat(s.RPS), fmtFloat(s.ARPS), fmtFloat(s.SuccessRate), fmtFloat(s.IntervalSRate), i(s.DeltaSucc), i(s.DeltaFail)},
+		append(lat(s.Latency), i(s.Late), i(s.Dropped), s.Stage, strconv.FormatBool(s.Warmup))...)}
+
+	for _, p := range s.Phases {
+		rows = append(rows, append([]string{ts, el, "phase", p.Name, "", "", "", "", "", "", "", "", ""}, append(lat(p.Latency), "", "", "", "")...))
+	}
+
+	for _, o := range s.Operations {
+		rows = append(rows, append([]string{ts, el, "op", o.Name,
+			i(o.Attempts), i(o.Success), i(o.Fail), fmtFloat(o.RPS), "", "", "", i(o.DeltaSucc), i(o.DeltaFail)},
+			append(lat(o.Latency), "", "", "", "")...))
+	}
+
+	for _, e := range s.Errors {
+		rows = append(rows, []string{ts, el, "error", e.Class, "", "", i(e.Count), "", "", "", "", "", i(e.Delta), "", "", "", "", "", "", "", "", "", ""})
+	}
+
+	return rows
+}
@@ -0,0 +1,92 @@
+package runner
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/croessner/ldapbench/internal/config"
+	"github.com/croessner/ldapbench/internal/metrics"
+)
+
+// In the open-loop arrival model a scheduler emits intended start times at the
+// configured rate regardless of how fast the server answers, and the workers
+// execute them in order. Because latency is measured from the intended start,
+// time spent waiting for a free worker is included and a stalled server shows
+// up in the percentiles instead of silently lowering the offered load
+// (coordinated omission).
+
+// dispatch records how late a scheduled iteration starts and runs it as w. It
+// reports false when no user is left.
+func (r *Runner) dispatch(w *worker, intended time.Time) bool {
+	delay := time.Since(intended)
+	m := r.m.Bucket()
+	m.Phase(metrics.PhaseSchedule).Record(delay, nil)
+
+	if delay > r.cfg.LateThreshold {
+		m.Late.Add(1)
+	}
+
+	return r.runAt(intended, w)
+}
+
+// schedule calls emit with the intended start times following the rate of the
+// load profile until ctx is done. With catchUp (open loop) overdue times are
+// emitted at once; without it (closed-loop rate limiter) missed times are
+// skipped like ticks of a time.Ticker. Stages without a rate limit pause the
+// schedule until the next stage.
+func (r *Runner) schedule(ctx context.Context, catchUp bool, emit func(time.Time)) {
+	next := r.start
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	for {
+		if d := time.Until(next); d > 0 {
+			timer.Reset(d)
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+		} else if ctx.Err() != nil {
+			return
+		} else if !catchUp {
+			next = time.Now()
+		}
+
+		rate := r.rateAt(next)
+		if rate <= 0 {
+			_, _, end := r.stageAt(next)
+			if !next.Before(end) {
+				return
+			}
+
+			next = end
+
+			continue
+		}
+
+		emit(next)
+		next = next.Add(r.interarrival(rate))
+	}
+}
+
+// interarrival returns the gap to the next intended start: 1/rate for
+// constant arrivals, exponentially distributed with mean 1/rate for Poisson,
+// drawn from the scheduler's own seeded source. Only the scheduler goroutine
+// calls it.
+func (r *Runner) interarrival(rate float64) time.Duration {
+	mean := float64(time.Second) / rate
+	if r.cfg.Arrival == config.ArrivalPoisson {
+		if r.schedRnd == nil {
+			r.schedRnd = rand.New(rand.NewPCG(r.cfg.Seed, math.MaxUint64))
+		}
+
+		mean *= r.schedRnd.ExpFloat64()
+	}
+
+	return max(time.Duration(mean), 1)
+}
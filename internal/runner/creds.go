@@ -0,0 +1,59 @@
+package runner
+
+import (
+	"math/rand/v2"
+	"sync"
+
+	"github.com/croessner/ldapbench/internal/csvdata"
+)
+
+// passwordChars is the alphabet for generated passwords. It mixes classes so
+// typical password quality checks accept the result.
+const passwordChars = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789-_.!"
+
+// credential holds the password a user currently has on the server. Its mutex
+// serializes password changes for the same user across workers.
+type credential struct {
+	mu       sync.Mutex
+	password string
+}
+
+// credentials tracks passwords changed during the run. Users without an
+// entry still have the password from the CSV.
+type credentials struct {
+	users sync.Map // username -> *credential
+}
+
+// acquire returns the locked credential of user. Callers must unlock cred.mu.
+func (c *credentials) acquire(user csvdata.User) *credential {
+	v, _ := c.users.LoadOrStore(user.Username, &credential{password: user.Password})
+	cred := v.(*credential)
+	cred.mu.Lock()
+
+	return cred
+}
+
+// current returns the password user currently has on the server.
+func (c *credentials) current(user csvdata.User) string {
+	v, ok := c.users.Load(user.Username)
+	if !ok {
+		return user.Password
+	}
+
+	cred := v.(*credential)
+	cred.mu.Lock()
+	defer cred.mu.Unlock()
+
+	return cred.password
+}
+
+// GeneratePassword returns a random password of length n drawn from rnd, as
+// passwd mode generates them.
+func GeneratePassword(rnd *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = passwordChars[rnd.IntN(len(passwordChars))]
+	}
+
+	return string(b)
+}
@@ -0,0 +1,192 @@
+package runner
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"github.com/croessner/ldapbench/internal/config"
+	"github.com/croessner/ldapbench/internal/csvdata"
+	"github.com/croessner/ldapbench/internal/metrics"
+)
+
+// call carries the inputs of one iteration's operations and the details
+// recorded with failures.
+type call struct {
+	m      *metrics.Metrics // bucket the iteration records into
+	rnd    *rand.Rand       // random source of the worker
+	user   csvdata.User
+	dn     string // user DN, or the entry DN for add/delete
+	detail string // filter or attribute, logged with failures
+
+	newPassword string // password set by passwd, redacted in failure logs
+}
+
+// operations is the registry of all operations selectable by modes and the
+// weighted mix. Adding an operation means adding a config.Op and an entry here.
+var operations = map[config.Op]func(r *Runner, c *call) error{
+	config.OpBind:    (*Runner).opBind,
+	config.OpSearch:  (*Runner).opSearch,
+	config.OpCompare: (*Runner).opCompare,
+	config.OpModify:  (*Runner).opModify,
+	config.OpAdd:     (*Runner).opAdd,
+	config.OpDelete:  (*Runner).opDelete,
+	config.OpPasswd:  (*Runner).opPasswd,
+}
+
+// opBind performs a simple bind as the user.
+func (r *Runner) opBind(c *call) error {
+	return r.client.UserBind(c.dn, r.creds.current(c.user))
+}
+
+// opSearch binds as the user and runs the configured search.
+func (r *Runner) opSearch(c *call) error {
+	c.detail = r.prepareFilter(c.user.Username)
+	_, err := r.client.UserSearch(c.dn, r.creds.current(c.user), c.detail)
+
+	return err
+}
+
+// opCompare binds as the user, compares the configured attribute of the
+// user's entry and counts compareTrue and compareFalse results separately.
+func (r *Runner) opCompare(c *call) error {
+	c.detail = c.user.Expand(r.cfg.CompareAttr)
+
+	ok, err := r.client.Compare(c.dn, r.creds.current(c.user), c.detail, c.user.Expand(r.cfg.CompareValue))
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		c.m.CompareTrue.Add(1)
+	} else {
+		c.m.CompareFalse.Add(1)
+	}
+
+	return nil
+}
+
+// opModify binds as the user and applies the configured change to the user's
+// entry.
+func (r *Runner) opModify(c *call) error {
+	c.detail = c.user.Expand(r.cfg.ModifyAttr)
+
+	var values []string
+	if v := r.expand(r.cfg.ModifyValue, c.user); v != "" {
+		values = []string{v}
+	}
+
+	return r.client.Modify(c.dn, r.creds.current(c.user), r.cfg.ModifyOp, c.detail, values)
+}
+
+// opAdd creates a new entry from the add templates and tracks it for cleanup.
+func (r *Runner) opAdd(c *call) error {
+	if err := r.addEntry(c); err != nil {
+		return err
+	}
+
+	r.created.push(c.dn)
+
+	return nil
+}
+
+// addEntry creates a new entry from the add templates without tracking it.
+func (r *Runner) addEntry(c *call) error {
+	dn, attrs := NewEntry(r.cfg, c.user, r.nextID())
+	c.dn = dn
+
+	return r.client.Add(dn, attrs)
+}
+
+// deleteTarget sets c.dn to an entry created earlier in the run. When none is
+// left, it adds one first, recorded as a separate add operation, so pure
+// delete workloads are self-sustaining. The entry is not tracked, so no other
+// worker can take it, and the add does not count toward the delete latency.
+func (r *Runner) deleteTarget(c *call) error {
+	if dn, ok := r.created.pop(); ok {
+		c.dn = dn
+
+		return nil
+	}
+
+	return r.record(config.OpAdd, c, (*Runner).addEntry)
+}
+
+// opDelete removes the entry chosen by deleteTarget.
+func (r *Runner) opDelete(c *call) error {
+	if err := r.client.Delete(c.dn); err != nil {
+		// Keep the entry tracked so Cleanup retries the removal.
+		r.created.push(c.dn)
+
+		return err
+	}
+
+	return nil
+}
+
+// opPasswd changes the user's password via Password Modify and, with
+// PasswdRotateBack, restores the previous one. Changes for the same user are
+// serialized, so each starts from the password the previous one left. Other
+// operations do not wait for a change; one that read the password before it
+// can reach the server afterwards and fail with invalid credentials.
+func (r *Runner) opPasswd(c *call) error {
+	cred := r.creds.acquire(c.user)
+	defer cred.mu.Unlock()
+
+	newPassword := r.newPassword(c, cred.password)
+	c.newPassword = newPassword
+	if err := r.client.PasswordModify(c.dn, cred.password, newPassword); err != nil {
+		return err
+	}
+
+	if !r.cfg.PasswdRotateBack {
+		cred.password = newPassword
+
+		return nil
+	}
+
+	if err := r.client.PasswordModify(c.dn, newPassword, cred.password); err != nil {
+		// The server now holds the new password; keep using it.
+		cred.password = newPassword
+
+		return err
+	}
+
+	return nil
+}
+
+// newPassword selects the target password: the CSV column new_password when
+// set (alternating with the original password once it is in use), otherwise a
+// generated one.
+func (r *Runner) newPassword(c *call, current string) string {
+	if np := c.user.Columns["new_password"]; np != "" {
+		if current == np {
+			return c.user.Password
+		}
+
+		return np
+	}
+
+	return GeneratePassword(c.rnd, r.cfg.PasswdLength)
+}
+
+// NewEntry builds the DN and attributes of an entry for add mode using id for
+// "{id}" placeholders. The naming attribute of the RDN is added to the
+// attributes when the templates omit it.
+func NewEntry(cfg *config.Config, user csvdata.User, id string) (string, map[string][]string) {
+	expand := func(tmpl string) string {
+		return user.Expand(strings.ReplaceAll(tmpl, "{id}", id))
+	}
+
+	rdn := expand(cfg.AddRDN)
+	attrs := make(map[string][]string, len(cfg.AddAttrs)+1)
+	for _, a := range cfg.AddAttrs {
+		attrs[a.Type] = append(attrs[a.Type], expand(a.Value))
+	}
+
+	if typ, val, ok := strings.Cut(rdn, "="); ok && !slices.Contains(attrs[typ], val) {
+		attrs[typ] = append(attrs[typ], val)
+	}
+
+	return rdn + "," + cfg.AddContainer, attrs
+}
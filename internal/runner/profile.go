@@ -0,0 +1,97 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/croessner/ldapbench/internal/config"
+)
+
+// stageAt returns the stage of the load profile active at t, the time elapsed
+// within it and its end. After the last stage the last stage is returned.
+func (r *Runner) stageAt(t time.Time) (st config.Stage, into time.Duration, end time.Time) {
+	begin := r.start
+	for _, st = range r.stages {
+		end = begin.Add(st.Duration)
+		if t.Before(end) {
+			return st, t.Sub(begin), end
+		}
+
+		begin = end
+	}
+
+	return st, st.Duration, end
+}
+
+// rateAt returns the target rate at t; 0 means unlimited.
+func (r *Runner) rateAt(t time.Time) float64 {
+	st, into, _ := r.stageAt(t)
+
+	return st.RateAt(into)
+}
+
+// limited reports whether any stage limits the rate.
+func (r *Runner) limited() bool {
+	for _, st := range r.stages {
+		if st.Rate > 0 || st.RateEnd > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// warmup runs the warm-up phase once before the first measured stage, at
+// first's rate and concurrency. Its measurements go to the separate warm-up
+// bucket of the metrics.
+func (r *Runner) warmup(ctx context.Context, first config.Stage) error {
+	if r.cfg.Warmup <= 0 || r.warmedUp {
+		return nil
+	}
+
+	r.warmedUp = true
+
+	// A ramp warms up at its initial rate.
+	first.Name, first.Duration, first.RateEnd = "warmup", r.cfg.Warmup, first.Rate
+
+	r.m.BeginWarmup()
+	defer r.m.EndWarmup()
+
+	if err := r.run(ctx, []config.Stage{first}, false); errors.Is(err, ErrUsersExhausted) {
+		return err
+	}
+
+	return ctx.Err()
+}
+
+// trackStages switches the stage metrics at every stage boundary. The first
+// stage must already have been started; run ends the last one once all
+// workers returned.
+func (r *Runner) trackStages(ctx context.Context) {
+	end := r.start
+	for i, st := range r.stages {
+		if i > 0 {
+			r.m.BeginStage(st.Name)
+		}
+
+		end = end.Add(st.Duration)
+		if !sleepUntil(ctx, end) {
+			return
+		}
+	}
+}
+
+// sleepUntil waits until t or until ctx is done and reports whether t was
+// reached.
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
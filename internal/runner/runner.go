@@ -5,10 +5,14 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math/rand"
+	"math/rand/v2"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/croessner/ldapbench/internal/config"
@@ -16,6 +20,7 @@ import (
 	"github.com/croessner/ldapbench/internal/fail"
 	"github.com/croessner/ldapbench/internal/ldapclient"
 	"github.com/croessner/ldapbench/internal/metrics"
+	"github.com/go-ldap/ldap/v3"
 )
 
 // Runner holds the components required to execute a scenario.
@@ -25,38 +30,146 @@ type Runner struct {
 	users  *csvdata.Users
 	m      *metrics.Metrics
 	flog   *fail.Logger
+
+	// runID and seq make generated entry names and values unique.
+	runID   string
+	seq     atomic.Int64
+	created tracker
+
+	// creds tracks passwords changed by passwd mode.
+	creds credentials
+
+	// start and stages describe the load profile of the running Run.
+	start  time.Time
+	stages []config.Stage
+
+	// warmedUp is set once the warm-up phase ran.
+	warmedUp bool
+
+	// User selection state: per-worker positions, the sequential cursor,
+	// the running weight sums and whether sequential selection ran out.
+	workers    []*worker
+	schedRnd   *rand.Rand // random source of the open-loop scheduler
+	userSeq    atomic.Int64
+	cumWeights []float64
+	exhausted  atomic.Bool
 }
 
 // New constructs a Runner.
 func New(cfg *config.Config, client ldapclient.Client, users *csvdata.Users, m *metrics.Metrics, flog *fail.Logger) *Runner {
-	return &Runner{cfg: cfg, client: client, users: users, m: m, flog: flog}
+	// The request sequence depends on the seed only, but generated names also
+	// carry the start time, so a repeated run does not collide with entries
+	// an earlier run with the same seed left behind. --run-id fixes them.
+	runID := cfg.RunID
+	if runID == "" {
+		runID = strconv.FormatUint(cfg.Seed, 36) + "." + strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+
+	return &Runner{cfg: cfg, client: client, users: users, m: m, flog: flog, runID: runID}
 }
 
 // Run executes until the configured duration elapses or the context is canceled.
+// With a load profile (cfg.Stages) the stages run in order; otherwise a single
+// implicit stage uses the flags' rate and concurrency.
 func (r *Runner) Run(ctx context.Context) error {
-	ctx, cancel := context.WithTimeout(ctx, r.cfg.Duration)
+	stages, track := r.cfg.Stages, true
+	if len(stages) == 0 {
+		stages, track = []config.Stage{{Duration: r.cfg.Duration, Rate: r.cfg.Rate, RateEnd: r.cfg.Rate, Concurrency: r.cfg.Concurrency}}, false
+	}
+
+	if err := r.warmup(ctx, stages[0]); err != nil {
+		return err
+	}
+
+	return r.run(ctx, stages, track)
+}
+
+// RunLevel runs a single stage called name at a fixed rate for the configured
+// duration and returns its metrics. The error is only set when ctx was
+// canceled before the stage ended.
+func (r *Runner) RunLevel(ctx context.Context, name string, rate float64) (*metrics.StageMetrics, error) {
+	level := config.Stage{Name: name, Duration: r.cfg.Duration, Rate: rate, RateEnd: rate, Concurrency: r.cfg.Concurrency}
+	if err := r.warmup(ctx, level); err != nil {
+		return nil, err
+	}
+
+	err := r.run(ctx, []config.Stage{level}, true)
+
+	stages := r.m.Stages()
+	if errors.Is(err, ErrUsersExhausted) {
+		return stages[len(stages)-1], err
+	}
+
+	return stages[len(stages)-1], ctx.Err()
+}
+
+// run executes stages in order. With track, every stage is recorded as
+// metrics.StageMetrics.
+func (r *Runner) run(ctx context.Context, stages []config.Stage, track bool) error {
+	var total time.Duration
+	for _, st := range stages {
+		total += st.Duration
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, total)
 	defer cancel()
 
+	r.start = time.Now()
+	r.stages = stages
+
 	wg := &sync.WaitGroup{}
-	wg.Add(r.cfg.Concurrency)
 
-	// Optional simple global rate limiter using a ticker.
-	var tick <-chan time.Time
-	var ticker *time.Ticker
+	if track {
+		r.m.BeginStage(r.stages[0].Name)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.trackStages(ctx)
+		}()
+	}
 
-	if r.cfg.Rate > 0 {
-		period := time.Duration(float64(time.Second) / r.cfg.Rate)
-		if period <= 0 {
-			period = time.Nanosecond
-		}
+	open := r.cfg.Arrival == config.ArrivalConstant || r.cfg.Arrival == config.ArrivalPoisson
 
-		ticker = time.NewTicker(period)
-		tick = ticker.C
+	// Open loop: the scheduler queues intended start times for the workers.
+	// Closed loop: an optional global rate limiter hands out ticks like a
+	// time.Ticker, dropping those no worker is waiting for.
+	var queue, tick chan time.Time
+	if open {
+		queue = make(chan time.Time, r.cfg.MaxBacklog)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.schedule(ctx, true, func(t time.Time) {
+				select {
+				case queue <- t:
+				default:
+					r.m.Bucket().Dropped.Add(1)
+				}
+			})
+		}()
+	} else if r.limited() {
+		tick = make(chan time.Time, 1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.schedule(ctx, false, func(t time.Time) {
+				select {
+				case tick <- t:
+				default:
+				}
+			})
+		}()
+	}
 
-		defer ticker.Stop()
+	n := 0
+	for _, st := range stages {
+		n = max(n, st.Concurrency)
 	}
 
-	for i := 0; i < r.cfg.Concurrency; i++ {
+	wg.Add(n)
+
+	for i := 0; i < n; i++ {
+		w := r.worker(i)
 		go func() {
 			defer wg.Done()
 			for {
@@ -66,99 +179,318 @@ func (r *Runner) Run(ctx context.Context) error {
 				default:
 				}
 
-				if tick != nil {
+				// Workers beyond the concurrency of the current stage idle
+				// until the next stage.
+				st, _, end := r.stageAt(time.Now())
+				if i >= st.Concurrency {
+					sleepUntil(ctx, end)
+
+					continue
+				}
+
+				if open {
+					select {
+					case <-ctx.Done():
+						return
+					case intended := <-queue:
+						if !r.dispatch(w, intended) {
+							r.exhaust(cancel)
+
+							return
+						}
+					case <-time.After(time.Until(end)):
+					}
+
+					continue
+				}
+
+				if tick != nil && r.rateAt(time.Now()) > 0 {
 					select {
 					case <-ctx.Done():
 						return
 					case <-tick:
+					case <-time.After(time.Until(end)):
+						continue
 					}
 				}
 
-				r.runOnce()
+				if !r.runAt(time.Now(), w) {
+					r.exhaust(cancel)
+
+					return
+				}
 			}
 		}()
 	}
 
 	wg.Wait()
 
+	// Attempts started just before the deadline still belong to the last
+	// stage, so it ends only after the workers returned.
+	if track {
+		r.m.EndStage()
+	}
+
+	if r.exhausted.Load() {
+		return ErrUsersExhausted
+	}
+
 	// return context error so caller can distinguish normal timeout
 	return ctx.Err()
 }
 
-// runOnce performs a single attempt depending on the configured mode.
-func (r *Runner) runOnce() {
-	r.m.Attempts.Add(1)
-	start := time.Now()
+// exhaust ends the run because no users are left.
+func (r *Runner) exhaust(cancel context.CancelFunc) {
+	r.exhausted.Store(true)
+	cancel()
+}
+
+// runOnce performs a single attempt as worker 0 and reports false when no user
+// is left: it picks a user, resolves the DN when an
+// operation needs it and executes the operations of the mode (or one operation
+// chosen from the mix) in order. The attempt fails at the first failing
+// operation.
+func (r *Runner) runOnce() bool { return r.runAt(time.Now(), r.worker(0)) }
+
+// runAt performs a single attempt of w like runOnce and measures its latency
+// from start, the intended start time in open-loop mode.
+func (r *Runner) runAt(start time.Time, w *worker) bool {
+	user, ok := r.pickUser(w)
+	if !ok {
+		return false
+	}
 
-	// record latency for the whole attempt (lookup + op); includes failures
-	defer func() {
-		r.m.Lat.Record(time.Since(start))
-	}()
+	// During the warm-up phase everything but the gauges is recorded into a
+	// separate bucket.
+	m := r.m.Bucket()
+	m.Attempts.Add(1)
+	r.m.InFlight.Add(1)
+	defer r.m.InFlight.Add(-1)
+
+	stage := r.m.Stage()
+	err := r.attempt(m, w, user)
+	if user.ExpectFail {
+		err = r.judgeNegative(m, user, err)
+	}
 
-	user := r.users.All[rand.Intn(len(r.users.All))]
+	// record latency for the whole attempt (lookup + ops); includes failures
+	d := time.Since(start)
+	m.Lat.Record(d)
 
-	// Lookup DN using the service account
-	dn, err := r.client.LookupDN(user.Username)
 	if err != nil {
-		r.m.Fail.Add(1)
-		if r.flog != nil {
-			r.flog.Log(fail.Record{Timestamp: time.Now(), Operation: "lookup", Username: user.Username, DN: "", Filter: "", Error: err.Error()})
-		}
+		m.Fail.Add(1)
+	} else {
+		m.Success.Add(1)
+	}
 
-		return
+	if stage != nil {
+		stage.Record(d, err)
 	}
 
-	switch r.cfg.Mode {
-	case config.ModeAuth:
-		if err := r.client.UserBind(dn, user.Password); err != nil {
-			r.m.Fail.Add(1)
-			if r.flog != nil {
-				r.flog.Log(fail.Record{Timestamp: time.Now(), Operation: "bind", Username: user.Username, DN: dn, Filter: "", Error: err.Error()})
+	return true
+}
+
+// attempt runs the lookup and operations of one iteration of w for user,
+// recording into m, and returns the first error.
+func (r *Runner) attempt(m *metrics.Metrics, w *worker, user csvdata.User) error {
+	ops := r.cfg.Mode.Ops()
+	if r.cfg.Mode == config.ModeMix {
+		ops = []config.Op{r.pickOp(w.rnd)}
+	}
+
+	if len(ops) == 0 {
+		// Should not happen due to validation
+		return errors.New("no operations configured")
+	}
+
+	c := &call{m: m, rnd: w.rnd, user: user}
+	if slices.ContainsFunc(ops, config.Op.NeedsDN) {
+		dn, err := UserDN(r.cfg, r.client, user)
+		if err != nil {
+			if expectedFailure(user, err) {
+				return err
 			}
 
-			return
+			m.CountError(ldapclient.ErrorClass(err))
+			r.logFailure(fail.Record{Timestamp: time.Now(), Operation: "lookup", Username: user.Username, DN: "", Filter: "", Error: err.Error(), ResultCode: ldapclient.ResultCode(err)}, c)
+
+			return err
 		}
 
-		r.m.Success.Add(1)
-	case config.ModeSearch:
-		filter := r.prepareFilter(user.Username)
-		if _, err := r.client.UserSearch(dn, user.Password, filter); err != nil {
-			r.m.Fail.Add(1)
-			if r.flog != nil {
-				r.flog.Log(fail.Record{Timestamp: time.Now(), Operation: "search", Username: user.Username, DN: dn, Filter: filter, Error: err.Error()})
-			}
+		c.dn = dn
+	}
 
-			return
+	for _, op := range ops {
+		if err := r.exec(op, c); err != nil {
+			return err
 		}
+	}
 
-		r.m.Success.Add(1)
-	case config.ModeBoth:
-		if err := r.client.UserBind(dn, user.Password); err != nil {
-			r.m.Fail.Add(1)
-			if r.flog != nil {
-				r.flog.Log(fail.Record{Timestamp: time.Now(), Operation: "bind", Username: user.Username, DN: dn, Filter: "", Error: err.Error()})
-			}
+	return nil
+}
+
+// UserDN returns the DN of user: the dn column of the CSV, the DN built from
+// --bind-dn-template or, without either, the DN searched by the lookup
+// account.
+func UserDN(cfg *config.Config, client ldapclient.Client, user csvdata.User) (string, error) {
+	switch {
+	case user.DN != "":
+		return user.DN, nil
+	case cfg.BindDNTemplate != "":
+		return strings.ReplaceAll(cfg.BindDNTemplate, "%s", ldap.EscapeDN(user.Username)), nil
+	default:
+		return client.LookupDN(user.Username)
+	}
+}
 
-			return
+// errUnexpectedSuccess is the outcome of a negative test case that succeeded.
+var errUnexpectedSuccess = errors.New("unexpected success: expected_ok=false")
+
+// classUnexpectedSuccess is the error class of errUnexpectedSuccess.
+const classUnexpectedSuccess = "unexpectedSuccess"
+
+// expectedFailure reports whether err is the failure a negative test case
+// expects: any error, or one with the expected LDAP result code.
+func expectedFailure(user csvdata.User, err error) bool {
+	if !user.ExpectFail || err == nil {
+		return false
+	}
+
+	return user.ExpectedCode == 0 || ldapclient.ResultCode(err) == user.ExpectedCode
+}
+
+// judgeNegative counts the outcome of a negative test case and returns the
+// iteration's error: nil for the expected failure, errUnexpectedSuccess when
+// it succeeded and err when it failed differently.
+func (r *Runner) judgeNegative(m *metrics.Metrics, user csvdata.User, err error) error {
+	m.Negative.Add(1)
+
+	switch {
+	case expectedFailure(user, err):
+		m.ExpectedFail.Add(1)
+
+		return nil
+	case err == nil:
+		m.UnexpectedSuccess.Add(1)
+		m.CountError(classUnexpectedSuccess)
+		r.logFailure(fail.Record{Timestamp: time.Now(), Operation: "expectation", Username: user.Username, Error: errUnexpectedSuccess.Error()}, &call{user: user})
+
+		return errUnexpectedSuccess
+	default:
+		m.UnexpectedFail.Add(1)
+
+		return err
+	}
+}
+
+// pickOp chooses an operation from the weighted mix using rnd.
+func (r *Runner) pickOp(rnd *rand.Rand) config.Op {
+	total := 0
+	for _, w := range r.cfg.Mix {
+		total += w.Weight
+	}
+
+	n := rnd.IntN(total)
+	for _, w := range r.cfg.Mix {
+		if n < w.Weight {
+			return w.Op
 		}
 
-		filter := r.prepareFilter(user.Username)
-		if _, err := r.client.UserSearch(dn, user.Password, filter); err != nil {
-			r.m.Fail.Add(1)
-			if r.flog != nil {
-				r.flog.Log(fail.Record{Timestamp: time.Now(), Operation: "search", Username: user.Username, DN: dn, Filter: filter, Error: err.Error()})
-			}
+		n -= w.Weight
+	}
+
+	return r.cfg.Mix[len(r.cfg.Mix)-1].Op
+}
+
+// exec runs a registered operation. A delete picks its target first, outside
+// the delete measurement.
+func (r *Runner) exec(op config.Op, c *call) error {
+	run, ok := operations[op]
+	if !ok {
+		return fmt.Errorf("unknown operation %q", op)
+	}
 
-			return
+	if op == config.OpDelete {
+		if err := r.deleteTarget(c); err != nil {
+			return err
 		}
+	}
 
-		r.m.Success.Add(1)
-	default:
-		// Should not happen due to validation
-		r.m.Fail.Add(1)
+	return r.record(op, c, run)
+}
+
+// record runs an operation, records its per-operation metrics and logs a
+// failure record when it fails.
+func (r *Runner) record(op config.Op, c *call, run func(r *Runner, c *call) error) error {
+	start := time.Now()
+	err := run(r, c)
+	c.m.Op(string(op)).Record(time.Since(start), err)
+
+	// The failure of a negative test case is the expected outcome, not an
+	// error.
+	if err != nil && !expectedFailure(c.user, err) {
+		name := string(op)
+		if op == config.OpPasswd && ldapclient.IsPolicyError(err) {
+			// Password policy rejections are counted separately as well.
+			c.m.PolicyFail.Add(1)
+			name = "passwd-policy"
+		}
+
+		c.m.CountError(ldapclient.ErrorClass(err))
+
+		r.logFailure(fail.Record{Timestamp: time.Now(), Operation: name, Username: c.user.Username, DN: c.dn, Filter: c.detail, Error: err.Error(), ResultCode: ldapclient.ResultCode(err)}, c)
+	}
+
+	return err
+}
 
-		fmt.Println("unknown mode")
+// logFailure writes rec to the failure log, if any, with every password of
+// the call's user and the lookup password redacted.
+func (r *Runner) logFailure(rec fail.Record, c *call) {
+	if r.flog == nil {
+		return
 	}
+
+	secrets := []string{c.user.Password, c.user.Columns["new_password"], r.creds.current(c.user), c.newPassword}
+	rec.DN = r.cfg.Redact(rec.DN, secrets...)
+	rec.Filter = r.cfg.Redact(rec.Filter, secrets...)
+	rec.Error = r.cfg.Redact(rec.Error, secrets...)
+
+	r.flog.Log(rec)
+}
+
+// expand resolves a template for user including the per-call "{id}" value.
+func (r *Runner) expand(tmpl string, user csvdata.User) string {
+	if strings.Contains(tmpl, "{id}") {
+		tmpl = strings.ReplaceAll(tmpl, "{id}", r.nextID())
+	}
+
+	return user.Expand(tmpl)
+}
+
+// nextID returns a value unique within this run.
+func (r *Runner) nextID() string {
+	return r.runID + "-" + strconv.FormatInt(r.seq.Add(1), 10)
+}
+
+// Cleanup deletes every entry created during the run that has not been
+// removed yet. It returns the number of deleted entries and a joined error for
+// entries that could not be removed.
+func (r *Runner) Cleanup() (int, error) {
+	var errs []error
+	n := 0
+
+	for _, dn := range r.created.drain() {
+		if err := r.client.Delete(dn); err != nil {
+			errs = append(errs, fmt.Errorf("delete %s: %w", dn, err))
+
+			continue
+		}
+
+		n++
+	}
+
+	return n, errors.Join(errs...)
 }
 
 // prepareFilter injects the username into the filter if %s placeholder exists.
@@ -1,23 +1,107 @@
 package runner
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/croessner/ldapbench/internal/config"
 	"github.com/croessner/ldapbench/internal/csvdata"
+	"github.com/croessner/ldapbench/internal/fail"
 	"github.com/croessner/ldapbench/internal/metrics"
+	"github.com/go-ldap/ldap/v3"
 )
 
 type fakeClient struct {
-	bindErr   error
-	searchErr error
+	bindErr    error
+	searchErr  error
+	compareErr error
+	compareOK  bool
+	addErr     error
+	deleteErr  error
+	passwdErr  error
+	bindDelay  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]map[string][]string
+	pw      map[string]string // dn -> current password for PasswordModify
 }
 
-func (f *fakeClient) BindLookup() error                                   { return nil }
-func (f *fakeClient) LookupDN(username string) (string, error)            { return "dn-" + username, nil }
-func (f *fakeClient) UserBind(dn, password string) error                  { return f.bindErr }
+func (f *fakeClient) BindLookup() error                        { return nil }
+func (f *fakeClient) LookupDN(username string) (string, error) { return "dn-" + username, nil }
+func (f *fakeClient) UserBind(dn, password string) error {
+	time.Sleep(f.bindDelay)
+
+	return f.bindErr
+}
 func (f *fakeClient) UserSearch(dn, password, filter string) (int, error) { return 1, f.searchErr }
-func (f *fakeClient) Close()                                              {}
+func (f *fakeClient) Compare(dn, password, attribute, value string) (bool, error) {
+	if f.bindErr != nil {
+		return false, f.bindErr
+	}
+
+	return f.compareOK, f.compareErr
+}
+func (f *fakeClient) Modify(dn, password string, op config.ModifyOp, attribute string, values []string) error {
+	return f.bindErr
+}
+func (f *fakeClient) Add(dn string, attrs map[string][]string) error {
+	if f.addErr != nil {
+		return f.addErr
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.entries == nil {
+		f.entries = make(map[string]map[string][]string)
+	}
+
+	f.entries[dn] = attrs
+
+	return nil
+}
+func (f *fakeClient) Delete(dn string) error {
+	if f.deleteErr != nil {
+		return f.deleteErr
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.entries[dn]; !ok {
+		return ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object: "+dn))
+	}
+
+	delete(f.entries, dn)
+
+	return nil
+}
+func (f *fakeClient) PasswordModify(dn, oldPassword, newPassword string) error {
+	if f.passwdErr != nil {
+		return f.passwdErr
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if cur, ok := f.pw[dn]; ok && cur != oldPassword {
+		return errors.New("invalid credentials")
+	}
+
+	f.pw[dn] = newPassword
+
+	return nil
+}
+func (f *fakeClient) PrewarmDNs(usernames []string) (int, error) { return len(usernames), nil }
+func (f *fakeClient) TLSState() (tls.ConnectionState, bool)      { return tls.ConnectionState{}, false }
+func (f *fakeClient) Close()                                     {}
 
 func TestPrepareFilter(t *testing.T) {
 	cfg := &config.Config{Filter: "(uid=%s)"}
@@ -35,6 +119,29 @@ func TestPrepareFilter(t *testing.T) {
 	}
 }
 
+func TestUserDN(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		user     csvdata.User
+		want     string
+	}{
+		{name: "lookup", user: csvdata.User{Username: "bob"}, want: "dn-bob"},
+		{name: "template", template: "uid=%s,ou=people,dc=example,dc=org", user: csvdata.User{Username: "bob"}, want: "uid=bob,ou=people,dc=example,dc=org"},
+		{name: "template escapes", template: "uid=%s,ou=people", user: csvdata.User{Username: " a,b+c=d#"}, want: `uid=\ a\,b\+c=d#,ou=people`},
+		{name: "csv column wins", template: "uid=%s,ou=people", user: csvdata.User{Username: "bob", DN: "cn=Bob,ou=staff"}, want: "cn=Bob,ou=staff"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := UserDN(&config.Config{BindDNTemplate: tc.template}, &fakeClient{}, tc.user)
+			if err != nil || got != tc.want {
+				t.Fatalf("UserDN = %q, %v; want %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
 func TestRunOnce_ModeAuth_Success(t *testing.T) {
 	cfg := &config.Config{Mode: config.ModeAuth}
 	users := &csvdata.Users{All: []csvdata.User{{Username: "bob", Password: "pw"}}}
@@ -48,3 +155,460 @@ func TestRunOnce_ModeAuth_Success(t *testing.T) {
 		t.Fatalf("metrics mismatch: att=%d suc=%d fail=%d", att, suc, fal)
 	}
 }
+
+func TestRunOnce_ModeCompare_CountsResults(t *testing.T) {
+	cfg := &config.Config{Mode: config.ModeCompare, CompareAttr: "userPassword", CompareValue: "{password}"}
+	users := &csvdata.Users{All: []csvdata.User{{Username: "bob", Password: "pw"}}}
+	m := metrics.New()
+
+	r := &Runner{cfg: cfg, client: &fakeClient{compareOK: true}, users: users, m: m}
+	r.runOnce()
+
+	r.client = &fakeClient{compareOK: false}
+	r.runOnce()
+
+	// The compare runs as the user, so a failing user bind fails it.
+	r.client = &fakeClient{compareOK: true, bindErr: ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("bad"))}
+	r.runOnce()
+
+	att, suc, fal, _ := m.Snapshot()
+	if att != 3 || suc != 2 || fal != 1 {
+		t.Fatalf("metrics mismatch: att=%d suc=%d fail=%d", att, suc, fal)
+	}
+
+	if m.CompareTrue.Load() != 1 || m.CompareFalse.Load() != 1 {
+		t.Fatalf("compare counters mismatch: true=%d false=%d", m.CompareTrue.Load(), m.CompareFalse.Load())
+	}
+}
+
+func TestNewEntry_AddsNamingAttribute(t *testing.T) {
+	cfg := &config.Config{
+		AddRDN:       "cn=bench-{id}",
+		AddContainer: "ou=tmp,dc=example,dc=org",
+		AddAttrs:     []config.AttrTemplate{{Type: "objectClass", Value: "person"}, {Type: "sn", Value: "%s"}},
+	}
+
+	dn, attrs := NewEntry(cfg, csvdata.User{Username: "bob"}, "42")
+	if dn != "cn=bench-42,ou=tmp,dc=example,dc=org" {
+		t.Fatalf("unexpected dn: %s", dn)
+	}
+
+	if got := attrs["cn"]; len(got) != 1 || got[0] != "bench-42" {
+		t.Fatalf("naming attribute missing: %v", attrs)
+	}
+
+	if got := attrs["sn"]; len(got) != 1 || got[0] != "bob" {
+		t.Fatalf("unexpected sn: %v", got)
+	}
+}
+
+func TestRunOnce_AddDeleteAndCleanup(t *testing.T) {
+	cfg := &config.Config{Mode: config.ModeAdd, AddRDN: "cn=bench-{id}", AddContainer: "dc=example,dc=org"}
+	users := &csvdata.Users{All: []csvdata.User{{Username: "bob", Password: "pw"}}}
+	m := metrics.New()
+	fc := &fakeClient{}
+	r := New(cfg, fc, users, m, nil)
+
+	for i := 0; i < 3; i++ {
+		r.runOnce()
+	}
+
+	if len(fc.entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(fc.entries))
+	}
+
+	for dn := range fc.entries {
+		if !strings.HasSuffix(dn, ",dc=example,dc=org") {
+			t.Fatalf("entry outside container: %s", dn)
+		}
+	}
+
+	// delete consumes one tracked entry, then creates and deletes on demand
+	cfg.Mode = config.ModeDelete
+	r.runOnce()
+
+	if len(fc.entries) != 2 {
+		t.Fatalf("expected 2 entries after delete, got %d", len(fc.entries))
+	}
+
+	n, err := r.Cleanup()
+	if err != nil || n != 2 || len(fc.entries) != 0 {
+		t.Fatalf("cleanup mismatch: n=%d err=%v left=%d", n, err, len(fc.entries))
+	}
+
+	r.runOnce()
+
+	if len(fc.entries) != 0 {
+		t.Fatalf("delete on empty tracker should leave no entries, got %d", len(fc.entries))
+	}
+
+	att, suc, fal, _ := m.Snapshot()
+	if att != 5 || suc != 5 || fal != 0 {
+		t.Fatalf("metrics mismatch: att=%d suc=%d fail=%d", att, suc, fal)
+	}
+}
+
+func TestRun_ConcurrentDelete(t *testing.T) {
+	cfg := &config.Config{Mode: config.ModeDelete, AddRDN: "cn=bench-{id}", AddContainer: "dc=example,dc=org", Concurrency: 8}
+	users := &csvdata.Users{All: []csvdata.User{{Username: "bob", Password: "pw"}}}
+	m := metrics.New()
+	fc := &fakeClient{}
+	r := New(cfg, fc, users, m, nil)
+
+	workers := make([]*worker, cfg.Concurrency)
+	for i := range workers {
+		workers[i] = r.worker(i)
+	}
+
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for range 200 {
+				r.runAt(time.Now(), w)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// Every delete removes the entry its own iteration added.
+	att, suc, fal, _ := m.Snapshot()
+	if att != 1600 || suc != 1600 || fal != 0 {
+		t.Fatalf("metrics mismatch: att=%d suc=%d fail=%d", att, suc, fal)
+	}
+
+	if len(fc.entries) != 0 || len(r.created.drain()) != 0 {
+		t.Fatalf("entries left behind: %d", len(fc.entries))
+	}
+
+	if adds, deletes := m.Op(string(config.OpAdd)).Attempts.Load(), m.Op(string(config.OpDelete)).Attempts.Load(); adds != 1600 || deletes != 1600 {
+		t.Fatalf("adds=%d deletes=%d, want 1600 each", adds, deletes)
+	}
+}
+
+func TestRunOnce_ModePasswd(t *testing.T) {
+	users := &csvdata.Users{All: []csvdata.User{{Username: "bob", Password: "pw"}}}
+
+	tests := []struct {
+		name       string
+		rotateBack bool
+		newCol     string
+		wantFinal  string // server password after two iterations; empty = any
+	}{
+		{name: "rotate back", rotateBack: true, wantFinal: "pw"},
+		{name: "generated", rotateBack: false},
+		{name: "csv column", rotateBack: false, newCol: "pw2", wantFinal: "pw"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Mode: config.ModePasswd, PasswdLength: 12, PasswdRotateBack: tt.rotateBack}
+			u := users.All[0]
+			u.Columns = map[string]string{"new_password": tt.newCol}
+			fc := &fakeClient{pw: map[string]string{"dn-bob": "pw"}}
+			m := metrics.New()
+			r := &Runner{cfg: cfg, client: fc, users: &csvdata.Users{All: []csvdata.User{u}}, m: m}
+
+			r.runOnce()
+			r.runOnce()
+
+			if _, suc, fal, _ := m.Snapshot(); suc != 2 || fal != 0 {
+				t.Fatalf("metrics mismatch: suc=%d fail=%d", suc, fal)
+			}
+
+			final := fc.pw["dn-bob"]
+			if got := r.creds.current(u); got != final {
+				t.Fatalf("tracked password %q differs from server %q", got, final)
+			}
+
+			if tt.wantFinal != "" && final != tt.wantFinal {
+				t.Fatalf("unexpected final password %q", final)
+			}
+		})
+	}
+}
+
+func TestRunOnce_ModePasswd_PolicyFailure(t *testing.T) {
+	cfg := &config.Config{Mode: config.ModePasswd, PasswdLength: 8}
+	users := &csvdata.Users{All: []csvdata.User{{Username: "bob", Password: "pw"}}}
+	m := metrics.New()
+	perr := ldap.NewError(ldap.LDAPResultConstraintViolation, errors.New("password in history"))
+	r := &Runner{cfg: cfg, client: &fakeClient{passwdErr: perr}, users: users, m: m}
+
+	r.runOnce()
+
+	if m.Fail.Load() != 1 || m.PolicyFail.Load() != 1 {
+		t.Fatalf("expected policy failure, got fail=%d policy=%d", m.Fail.Load(), m.PolicyFail.Load())
+	}
+}
+
+func TestRunOnce_NegativeCases(t *testing.T) {
+	invalid := ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+
+	tests := []struct {
+		name    string
+		user    csvdata.User
+		bindErr error
+
+		success, fail                int64
+		expected, unexpSuc, unexpErr int64
+		errClass                     string
+	}{
+		{name: "positive", user: csvdata.User{Username: "bob"}, success: 1},
+		{name: "expected failure", user: csvdata.User{Username: "bob", ExpectFail: true}, bindErr: invalid, success: 1, expected: 1},
+		{name: "expected code", user: csvdata.User{Username: "bob", ExpectFail: true, ExpectedCode: 49}, bindErr: invalid, success: 1, expected: 1},
+		{name: "unexpected success", user: csvdata.User{Username: "bob", ExpectFail: true}, fail: 1, unexpSuc: 1, errClass: classUnexpectedSuccess},
+		{name: "other code", user: csvdata.User{Username: "bob", ExpectFail: true, ExpectedCode: 53}, bindErr: invalid, fail: 1, unexpErr: 1, errClass: "invalidCredentials"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := metrics.New()
+			users := &csvdata.Users{All: []csvdata.User{tc.user}}
+			r := &Runner{cfg: &config.Config{Mode: config.ModeAuth}, client: &fakeClient{bindErr: tc.bindErr}, users: users, m: m}
+
+			r.runOnce()
+
+			if m.Success.Load() != tc.success || m.Fail.Load() != tc.fail {
+				t.Fatalf("success=%d fail=%d, want %d/%d", m.Success.Load(), m.Fail.Load(), tc.success, tc.fail)
+			}
+
+			if m.ExpectedFail.Load() != tc.expected || m.UnexpectedSuccess.Load() != tc.unexpSuc || m.UnexpectedFail.Load() != tc.unexpErr {
+				t.Fatalf("expected=%d unexpected_success=%d unexpected_failure=%d", m.ExpectedFail.Load(), m.UnexpectedSuccess.Load(), m.UnexpectedFail.Load())
+			}
+
+			errs := m.Errors()
+			if tc.errClass == "" && len(errs) != 0 || tc.errClass != "" && (len(errs) != 1 || errs[0].Class != tc.errClass) {
+				t.Fatalf("unexpected error classes: %+v", errs)
+			}
+		})
+	}
+}
+
+func TestFailureLogRedactsPasswords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fail.csv")
+	flog := fail.New(path, 1)
+
+	cfg := &config.Config{Mode: config.ModeAuth, LookupBindPass: "lookup-pw"}
+	users := &csvdata.Users{All: []csvdata.User{{Username: "bob", Password: "bob-pw"}}}
+	bindErr := errors.New("bind rejected: bob-pw does not match, lookup-pw")
+	r := &Runner{cfg: cfg, client: &fakeClient{bindErr: bindErr}, users: users, m: metrics.New(), flog: flog}
+
+	r.runOnce()
+	flog.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out := string(data); strings.Contains(out, "bob-pw") || strings.Contains(out, "lookup-pw") || !strings.Contains(out, "bind rejected: REDACTED does not match, REDACTED") {
+		t.Fatalf("passwords not redacted in failure log: %s", out)
+	}
+}
+
+func TestRunOnce_ModeMix_PerOpMetrics(t *testing.T) {
+	cfg := &config.Config{
+		Mode:         config.ModeMix,
+		Mix:          []config.WeightedOp{{Op: config.OpBind, Weight: 3}, {Op: config.OpCompare, Weight: 1}},
+		CompareAttr:  "userPassword",
+		CompareValue: "{password}",
+	}
+	users := &csvdata.Users{All: []csvdata.User{{Username: "bob", Password: "pw"}}}
+	m := metrics.New()
+	r := &Runner{cfg: cfg, client: &fakeClient{compareOK: true}, users: users, m: m}
+
+	const n = 4000
+	for i := 0; i < n; i++ {
+		r.runOnce()
+	}
+
+	binds := m.Op("bind").Attempts.Load()
+	compares := m.Op("compare").Attempts.Load()
+	if binds+compares != n {
+		t.Fatalf("expected %d operations, got bind=%d compare=%d", n, binds, compares)
+	}
+
+	// 75% binds expected; allow generous slack for randomness
+	if share := float64(binds) / n; share < 0.70 || share > 0.80 {
+		t.Fatalf("bind share %.2f outside expected range", share)
+	}
+
+	if got := m.OpNames(); len(got) != 2 || got[0] != "bind" || got[1] != "compare" {
+		t.Fatalf("unexpected op names: %v", got)
+	}
+}
+
+func TestOperationsRegistryCoversAllOps(t *testing.T) {
+	for _, op := range []config.Op{config.OpBind, config.OpSearch, config.OpCompare, config.OpModify, config.OpAdd, config.OpDelete, config.OpPasswd} {
+		if _, ok := operations[op]; !ok {
+			t.Fatalf("operation %q not registered", op)
+		}
+	}
+}
+
+func TestRunOpen_MeasuresFromIntendedStart(t *testing.T) {
+	cfg := &config.Config{
+		Mode:          config.ModeAuth,
+		Arrival:       config.ArrivalConstant,
+		Rate:          1000,
+		Concurrency:   1,
+		MaxBacklog:    20,
+		LateThreshold: time.Millisecond,
+		Duration:      200 * time.Millisecond,
+	}
+	users := &csvdata.Users{All: []csvdata.User{{Username: "bob", Password: "pw"}}}
+	m := metrics.New()
+
+	// A single worker needing 5ms per bind cannot keep up with 1000/s.
+	r := New(cfg, &fakeClient{bindDelay: 5 * time.Millisecond}, users, m, nil)
+	if err := r.Run(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected run error: %v", err)
+	}
+
+	if m.Late.Load() == 0 || m.Dropped.Load() == 0 {
+		t.Fatalf("expected late and dropped schedules, got late=%d dropped=%d", m.Late.Load(), m.Dropped.Load())
+	}
+
+	// Queueing delay is part of the latency, so the tail far exceeds the
+	// service time of a single bind.
+	if p99 := m.Lat.TotalSnapshot().P99; p99 < 20*time.Millisecond {
+		t.Fatalf("p99 = %v, expected queueing delay to be included", p99)
+	}
+
+	if op := m.Op("bind").Lat.TotalSnapshot(); op.Max > 50*time.Millisecond {
+		t.Fatalf("op latency should be service time only, max = %v", op.Max)
+	}
+}
+
+func TestInterarrival(t *testing.T) {
+	r := &Runner{cfg: &config.Config{Arrival: config.ArrivalConstant}}
+	if got := r.interarrival(100); got != 10*time.Millisecond {
+		t.Fatalf("constant gap = %v", got)
+	}
+
+	r.cfg.Arrival = config.ArrivalPoisson
+
+	var sum time.Duration
+	for range 10000 {
+		sum += r.interarrival(100)
+	}
+
+	if mean := sum / 10000; mean < 9*time.Millisecond || mean > 11*time.Millisecond {
+		t.Fatalf("poisson mean gap = %v, want about 10ms", mean)
+	}
+	// The scheduler's source is seeded, so gaps repeat with the same seed.
+	a := &Runner{cfg: &config.Config{Arrival: config.ArrivalPoisson, Seed: 7}}
+	b := &Runner{cfg: &config.Config{Arrival: config.ArrivalPoisson, Seed: 7}}
+	for range 100 {
+		if x, y := a.interarrival(100), b.interarrival(100); x != y {
+			t.Fatalf("same seed gave different gaps %v and %v", x, y)
+		}
+	}
+}
+
+func TestRun_Stages(t *testing.T) {
+	cfg := &config.Config{
+		Mode:        config.ModeAuth,
+		Concurrency: 1,
+		Stages: []config.Stage{
+			{Name: "slow", Duration: 150 * time.Millisecond, Rate: 20, RateEnd: 20, Concurrency: 1},
+			{Name: "fast", Duration: 150 * time.Millisecond, Rate: 200, RateEnd: 200, Concurrency: 2},
+		},
+		Duration: 300 * time.Millisecond,
+	}
+	users := &csvdata.Users{All: []csvdata.User{{Username: "bob", Password: "pw"}}}
+	m := metrics.New()
+
+	r := New(cfg, &fakeClient{}, users, m, nil)
+	if err := r.Run(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected run error: %v", err)
+	}
+
+	stages := m.Stages()
+	if len(stages) != 2 || stages[0].Name != "slow" || stages[1].Name != "fast" {
+		t.Fatalf("unexpected stages: %+v", stages)
+	}
+
+	if m.Stage() != nil {
+		t.Fatalf("expected no running stage after Run")
+	}
+
+	slow, fast := stages[0].Attempts.Load(), stages[1].Attempts.Load()
+	if slow > 6 || fast < 15 || fast > 40 {
+		t.Fatalf("stage attempts slow=%d fast=%d do not follow the stage rates", slow, fast)
+	}
+
+	if slow+fast != m.Attempts.Load() {
+		t.Fatalf("stage attempts %d+%d != total %d", slow, fast, m.Attempts.Load())
+	}
+}
+
+func TestStageAt(t *testing.T) {
+	start := time.Now()
+	r := &Runner{start: start, stages: []config.Stage{
+		{Name: "a", Duration: time.Second, Rate: 10, RateEnd: 10},
+		{Name: "b", Duration: 2 * time.Second, Rate: 100, RateEnd: 300},
+	}}
+
+	if st, into, end := r.stageAt(start.Add(500 * time.Millisecond)); st.Name != "a" || into != 500*time.Millisecond || !end.Equal(start.Add(time.Second)) {
+		t.Fatalf("stageAt(0.5s) = %s %v %v", st.Name, into, end)
+	}
+
+	if got := r.rateAt(start.Add(2 * time.Second)); got != 200 {
+		t.Fatalf("rateAt(2s) = %v, want 200", got)
+	}
+
+	if st, _, _ := r.stageAt(start.Add(time.Hour)); st.Name != "b" {
+		t.Fatalf("stageAt after the end = %s, want b", st.Name)
+	}
+}
+
+func TestRunLevel(t *testing.T) {
+	cfg := &config.Config{Mode: config.ModeAuth, Concurrency: 2, Duration: 100 * time.Millisecond}
+	users := &csvdata.Users{All: []csvdata.User{{Username: "bob", Password: "pw"}}}
+	m := metrics.New()
+	r := New(cfg, &fakeClient{}, users, m, nil)
+
+	for _, rate := range []float64{50, 200} {
+		st, err := r.RunLevel(context.Background(), "level", rate)
+		if err != nil {
+			t.Fatalf("RunLevel: %v", err)
+		}
+
+		if want := int64(rate / 10); st.Attempts.Load() < want/2 || st.Attempts.Load() > want*2 {
+			t.Fatalf("rate %v: %d attempts, expected about %d", rate, st.Attempts.Load(), want)
+		}
+	}
+
+	if len(m.Stages()) != 2 {
+		t.Fatalf("expected one stage per level, got %d", len(m.Stages()))
+	}
+}
+
+func TestRun_WarmupExcluded(t *testing.T) {
+	cfg := &config.Config{Mode: config.ModeCompare, Concurrency: 1, Rate: 100, Duration: 100 * time.Millisecond, Warmup: 100 * time.Millisecond}
+	users := &csvdata.Users{All: []csvdata.User{{Username: "bob", Password: "pw"}}}
+	m := metrics.New()
+
+	r := New(cfg, &fakeClient{compareOK: true}, users, m, nil)
+	if err := r.Run(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected run error: %v", err)
+	}
+
+	wm := m.Warmup()
+	if wm == nil || wm.Attempts.Load() == 0 || wm.CompareTrue.Load() != wm.Success.Load() || wm.Op("compare").Attempts.Load() != wm.Attempts.Load() {
+		t.Fatalf("warm-up iterations not recorded into the warm-up bucket: %+v", wm)
+	}
+
+	if m.Attempts.Load() == 0 || m.Op("compare").Attempts.Load() != m.Attempts.Load() || m.CompareTrue.Load() != m.Success.Load() {
+		t.Fatalf("measured iterations mixed with warm-up: attempts=%d op=%d", m.Attempts.Load(), m.Op("compare").Attempts.Load())
+	}
+
+	if el := time.Since(m.WarmupEnd()); el < 90*time.Millisecond {
+		t.Fatalf("warm-up ended %v before the end of the run, expected about --duration", el)
+	}
+}
@@ -0,0 +1,44 @@
+package runner
+
+import "sync"
+
+// tracker remembers entries created during a run so delete mode can consume
+// them and Cleanup can remove whatever is left at shutdown.
+type tracker struct {
+	mu  sync.Mutex
+	dns []string
+}
+
+// push records a created entry.
+func (t *tracker) push(dn string) {
+	t.mu.Lock()
+	t.dns = append(t.dns, dn)
+	t.mu.Unlock()
+}
+
+// pop removes and returns the most recently created entry.
+func (t *tracker) pop() (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := len(t.dns)
+	if n == 0 {
+		return "", false
+	}
+
+	dn := t.dns[n-1]
+	t.dns = t.dns[:n-1]
+
+	return dn, true
+}
+
+// drain removes and returns all tracked entries.
+func (t *tracker) drain() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	dns := t.dns
+	t.dns = nil
+
+	return dns
+}
@@ -0,0 +1,115 @@
+package runner
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sort"
+
+	"github.com/croessner/ldapbench/internal/config"
+	"github.com/croessner/ldapbench/internal/csvdata"
+)
+
+// ErrUsersExhausted ends a run with sequential user selection once every
+// user was used.
+var ErrUsersExhausted = errors.New("all users used")
+
+// worker holds the per-worker random source and user selection state.
+// Workers keep their state across the runs of warm-up, stages and search
+// levels. The source is seeded from cfg.Seed and the worker id, so a worker
+// draws the same sequence in every run with the same seed.
+type worker struct {
+	id     int
+	rnd    *rand.Rand
+	pos    int // next user for round-robin and partitioned selection
+	lo, hi int // partition owned by the worker
+	zipf   *rand.Zipf
+}
+
+// worker returns the state of worker id, creating it on first use. It must not
+// be called concurrently.
+func (r *Runner) worker(id int) *worker {
+	if r.cfg.UserSelect == config.UserSelectWeighted && r.cumWeights == nil {
+		r.cumWeights = cumulative(r.users.All)
+	}
+
+	for len(r.workers) <= id {
+		r.workers = append(r.workers, r.newWorker(len(r.workers)))
+	}
+
+	return r.workers[id]
+}
+
+// newWorker prepares the selection state of worker id. Round-robin workers
+// start at evenly spread offsets; partitions split the users into disjoint
+// slices, or share single users when there are more workers than users.
+func (r *Runner) newWorker(id int) *worker {
+	n := len(r.users.All)
+	workers := max(r.cfg.MaxConcurrency(), 1)
+	w := &worker{id: id, rnd: rand.New(rand.NewPCG(r.cfg.Seed, uint64(id)))}
+
+	switch r.cfg.UserSelect {
+	case config.UserSelectRoundRobin:
+		w.pos = id * n / workers % n
+	case config.UserSelectPartitioned:
+		w.lo, w.hi = id*n/workers, (id+1)*n/workers
+		if w.lo >= w.hi {
+			w.lo = id % n
+			w.hi = w.lo + 1
+		}
+
+		w.pos = w.lo
+	case config.UserSelectZipf:
+		w.zipf = rand.NewZipf(w.rnd, r.cfg.ZipfExponent, 1, uint64(n-1))
+	}
+
+	return w
+}
+
+// pickUser returns the user of w's next iteration. It reports false when
+// sequential selection used every user.
+func (r *Runner) pickUser(w *worker) (csvdata.User, bool) {
+	all := r.users.All
+
+	switch r.cfg.UserSelect {
+	case config.UserSelectSequential:
+		i := r.userSeq.Add(1) - 1
+		if i >= int64(len(all)) {
+			return csvdata.User{}, false
+		}
+
+		return all[i], true
+	case config.UserSelectRoundRobin:
+		u := all[w.pos]
+		w.pos = (w.pos + 1) % len(all)
+
+		return u, true
+	case config.UserSelectPartitioned:
+		u := all[w.pos]
+		if w.pos++; w.pos >= w.hi {
+			w.pos = w.lo
+		}
+
+		return u, true
+	case config.UserSelectZipf:
+		return all[w.zipf.Uint64()], true
+	case config.UserSelectWeighted:
+		x := w.rnd.Float64() * r.cumWeights[len(r.cumWeights)-1]
+
+		return all[sort.Search(len(all), func(i int) bool { return r.cumWeights[i] > x })], true
+	default:
+		return all[w.rnd.IntN(len(all))], true
+	}
+}
+
+// cumulative returns the running sums of the user weights.
+func cumulative(users []csvdata.User) []float64 {
+	cum := make([]float64, len(users))
+
+	var sum float64
+	for i, u := range users {
+		sum += u.Weight
+		cum[i] = sum
+	}
+
+	return cum
+}
@@ -0,0 +1,193 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/croessner/ldapbench/internal/config"
+	"github.com/croessner/ldapbench/internal/csvdata"
+	"github.com/croessner/ldapbench/internal/metrics"
+)
+
+func testUsers(n int) *csvdata.Users {
+	users := &csvdata.Users{}
+	for i := 0; i < n; i++ {
+		users.All = append(users.All, csvdata.User{Username: string(rune('a' + i)), Password: "pw", Weight: 1})
+	}
+
+	return users
+}
+
+// picks returns the usernames picked by worker id in n iterations.
+func picks(r *Runner, id, n int) []string {
+	var out []string
+	for i := 0; i < n; i++ {
+		u, ok := r.pickUser(r.worker(id))
+		if !ok {
+			break
+		}
+
+		out = append(out, u.Username)
+	}
+
+	return out
+}
+
+func TestPickUser(t *testing.T) {
+	tests := []struct {
+		sel  config.UserSelect
+		id   int
+		want []string
+	}{
+		{sel: config.UserSelectSequential, id: 0, want: []string{"a", "b", "c", "d"}},
+		{sel: config.UserSelectRoundRobin, id: 0, want: []string{"a", "b", "c", "d", "a", "b"}},
+		{sel: config.UserSelectRoundRobin, id: 1, want: []string{"c", "d", "a", "b", "c", "d"}},
+		{sel: config.UserSelectPartitioned, id: 0, want: []string{"a", "b", "a", "b", "a", "b"}},
+		{sel: config.UserSelectPartitioned, id: 1, want: []string{"c", "d", "c", "d", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		r := &Runner{cfg: &config.Config{UserSelect: tt.sel, Concurrency: 2}, users: testUsers(4)}
+		if got := picks(r, tt.id, 6); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s worker %d picked %v, want %v", tt.sel, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestPickUser_Partitioned_MoreWorkersThanUsers(t *testing.T) {
+	r := &Runner{cfg: &config.Config{UserSelect: config.UserSelectPartitioned, Concurrency: 5}, users: testUsers(2)}
+	used := make(map[string]bool)
+	for id := 0; id < 5; id++ {
+		got := picks(r, id, 3)
+		if got[0] != got[1] || got[1] != got[2] {
+			t.Fatalf("worker %d picked %v, want a single shared user", id, got)
+		}
+
+		used[got[0]] = true
+	}
+
+	if len(used) != 2 {
+		t.Fatalf("expected both users in use, got %v", used)
+	}
+}
+
+func TestPickUser_Skewed(t *testing.T) {
+	users := testUsers(10)
+	users.All[3].Weight = 0
+	users.All[7].Weight = 20
+
+	tests := []struct {
+		cfg   config.Config
+		check func(counts map[string]int) bool
+	}{
+		{
+			cfg:   config.Config{UserSelect: config.UserSelectZipf, ZipfExponent: 2},
+			check: func(c map[string]int) bool { return c["a"] > c["b"] && c["b"] > c["j"] && c["a"] > 5000 },
+		},
+		{
+			cfg:   config.Config{UserSelect: config.UserSelectWeighted},
+			check: func(c map[string]int) bool { return c["d"] == 0 && c["h"] > 5000 && c["a"] > 0 },
+		},
+	}
+
+	for _, tt := range tests {
+		r := &Runner{cfg: &tt.cfg, users: users}
+
+		counts := make(map[string]int)
+		for _, u := range picks(r, 0, 10000) {
+			counts[u]++
+		}
+
+		if !tt.check(counts) {
+			t.Fatalf("%s: unexpected distribution %v", tt.cfg.UserSelect, counts)
+		}
+	}
+}
+
+func TestRun_SequentialStopsWhenExhausted(t *testing.T) {
+	cfg := &config.Config{Mode: config.ModeAuth, UserSelect: config.UserSelectSequential, Concurrency: 3, Duration: 5 * time.Second}
+	m := metrics.New()
+
+	r := New(cfg, &fakeClient{}, testUsers(7), m, nil)
+	if err := r.Run(context.Background()); !errors.Is(err, ErrUsersExhausted) {
+		t.Fatalf("expected ErrUsersExhausted, got %v", err)
+	}
+
+	if m.Attempts.Load() != 7 {
+		t.Fatalf("expected every user exactly once, got %d attempts", m.Attempts.Load())
+	}
+}
+
+// recordingClient logs every request it receives.
+type recordingClient struct {
+	fakeClient
+	log []string
+}
+
+func (c *recordingClient) UserBind(dn, password string) error {
+	c.log = append(c.log, "bind "+dn+" "+password)
+
+	return nil
+}
+
+func (c *recordingClient) Compare(dn, password, attribute, value string) (bool, error) {
+	c.log = append(c.log, "compare "+dn+" "+attribute+" "+value)
+
+	return true, nil
+}
+
+func (c *recordingClient) Modify(dn, password string, op config.ModifyOp, attribute string, values []string) error {
+	c.log = append(c.log, "modify "+dn+" "+attribute+" "+strings.Join(values, ","))
+
+	return nil
+}
+
+func (c *recordingClient) PasswordModify(dn, oldPassword, newPassword string) error {
+	c.log = append(c.log, "passwd "+dn+" "+oldPassword+" "+newPassword)
+
+	return nil
+}
+
+func TestSeed_IdenticalRequestSequence(t *testing.T) {
+	requests := func(seed uint64, runID string) []string {
+		cfg := &config.Config{
+			Mode:         config.ModeMix,
+			Mix:          []config.WeightedOp{{Op: config.OpBind, Weight: 2}, {Op: config.OpCompare, Weight: 1}, {Op: config.OpModify, Weight: 1}, {Op: config.OpPasswd, Weight: 1}},
+			UserSelect:   config.UserSelectZipf,
+			ZipfExponent: 1.5,
+			CompareAttr:  "mail",
+			CompareValue: "%s",
+			ModifyAttr:   "description",
+			ModifyValue:  "{id}",
+			PasswdLength: 8,
+			Concurrency:  1,
+			Seed:         seed,
+			RunID:        runID,
+		}
+		c := &recordingClient{}
+		r := New(cfg, c, testUsers(20), metrics.New(), nil)
+		for i := 0; i < 300; i++ {
+			r.runOnce()
+		}
+
+		return c.log
+	}
+
+	a, b := requests(42, "run"), requests(42, "run")
+	if len(a) < 300 || !reflect.DeepEqual(a, b) {
+		t.Fatalf("same seed issued different requests (%d vs %d)", len(a), len(b))
+	}
+
+	if reflect.DeepEqual(a, requests(43, "run")) {
+		t.Fatalf("different seeds issued identical requests")
+	}
+
+	// Without --run-id generated values differ between runs with the same seed.
+	if reflect.DeepEqual(requests(42, ""), requests(42, "")) {
+		t.Fatalf("runs without run id generated identical values")
+	}
+}
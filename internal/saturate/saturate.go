@@ -0,0 +1,165 @@
+package saturate
+
+// Package saturate searches the highest request rate a server sustains within
+// an SLO. It runs fixed-rate levels one after another, judges every level by
+// its latency, error rate and achieved throughput, and raises the rate
+// linearly or bisects a range until the SLO breaks.
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/croessner/ldapbench/internal/config"
+	"github.com/croessner/ldapbench/internal/metrics"
+)
+
+// LevelFunc runs one level called name at rate and returns its metrics. An
+// error means the level was interrupted and cannot be judged.
+type LevelFunc func(ctx context.Context, name string, rate float64) (*metrics.StageMetrics, error)
+
+// Level is the outcome of one tested rate.
+type Level struct {
+	Name      string
+	Rate      float64 // target requests per second
+	Achieved  float64 // attempted iterations per second
+	P99       time.Duration
+	ErrorRate float64 // failed iterations in percent
+	Pass      bool
+	Reason    string // why the level failed the SLO
+}
+
+// Result is the outcome of a search.
+type Result struct {
+	Search config.Search
+	SLO    config.SLO
+	Levels []Level // in the order they were tested
+	Max    *Level  // highest passing level; nil if none passed
+}
+
+// Curve returns the levels ordered by rate.
+func (r *Result) Curve() []Level {
+	levels := append([]Level(nil), r.Levels...)
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Rate < levels[j].Rate })
+
+	return levels
+}
+
+// Search tests rates following cfg.FindMax and returns the levels tested so
+// far, also when ctx is canceled (together with the context error).
+func Search(ctx context.Context, cfg *config.Config, run LevelFunc) (*Result, error) {
+	s := &searcher{cfg: cfg, run: run, res: &Result{Search: cfg.FindMax, SLO: cfg.SLO}}
+
+	var err error
+	if cfg.FindMax == config.SearchBinary {
+		err = s.binary(ctx)
+	} else {
+		err = s.linear(ctx)
+	}
+
+	return s.res, err
+}
+
+type searcher struct {
+	cfg *config.Config
+	run LevelFunc
+	res *Result
+}
+
+// linear raises the rate by FindStep from FindFrom until a level fails or the
+// rate exceeds FindTo.
+func (s *searcher) linear(ctx context.Context) error {
+	for i := 0; ; i++ {
+		rate := s.cfg.FindFrom + float64(i)*s.cfg.FindStep
+		if s.cfg.FindTo > 0 && rate > s.cfg.FindTo {
+			return nil
+		}
+
+		pass, err := s.test(ctx, rate)
+		if err != nil || !pass {
+			return err
+		}
+	}
+}
+
+// binary checks both ends of the range and then bisects it until the passing
+// and failing rates are at most FindStep apart. Tested rates are multiples of
+// FindStep above FindFrom.
+func (s *searcher) binary(ctx context.Context) error {
+	lo, hi := s.cfg.FindFrom, s.cfg.FindTo
+
+	if pass, err := s.test(ctx, lo); err != nil || !pass {
+		return err
+	}
+
+	if pass, err := s.test(ctx, hi); err != nil || pass {
+		return err
+	}
+
+	step := s.cfg.FindStep
+	for hi-lo > step {
+		mid := lo + math.Round((hi-lo)/2/step)*step
+
+		pass, err := s.test(ctx, mid)
+		if err != nil {
+			return err
+		}
+
+		if pass {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return nil
+}
+
+// test runs one level and records its verdict.
+func (s *searcher) test(ctx context.Context, rate float64) (bool, error) {
+	st, err := s.run(ctx, "rate"+strconv.FormatFloat(rate, 'f', -1, 64), rate)
+	if err != nil {
+		return false, err
+	}
+
+	l := Judge(st, rate, s.cfg.SLO)
+	s.res.Levels = append(s.res.Levels, l)
+
+	if l.Pass && (s.res.Max == nil || l.Rate > s.res.Max.Rate) {
+		s.res.Max = &l
+	}
+
+	return l.Pass, nil
+}
+
+// Judge evaluates the stage metrics of a level at rate against slo.
+func Judge(st *metrics.StageMetrics, rate float64, slo config.SLO) Level {
+	att, fail := st.Attempts.Load(), st.Fail.Load()
+	l := Level{Name: st.Name, Rate: rate, P99: st.Lat.TotalSnapshot().P99}
+
+	if el := st.Elapsed(); el > 0 {
+		l.Achieved = float64(att) / el.Seconds()
+	}
+
+	if att > 0 {
+		l.ErrorRate = float64(fail) * 100 / float64(att)
+	}
+
+	switch {
+	case att == 0:
+		l.Reason = "no iterations"
+	case slo.P99 > 0 && l.P99 > slo.P99:
+		l.Reason = fmt.Sprintf("p99 %v > %v", l.P99, slo.P99)
+	case slo.ErrorRate > 0 && l.ErrorRate > slo.ErrorRate:
+		l.Reason = fmt.Sprintf("error rate %.2f%% > %g%%", l.ErrorRate, slo.ErrorRate)
+	case slo.Throughput > 0 && l.Achieved < rate*slo.Throughput/100:
+		l.Reason = fmt.Sprintf("achieved %.2f/s < %g%% of %g/s", l.Achieved, slo.Throughput, rate)
+	default:
+		l.Pass = true
+	}
+
+	return l
+}
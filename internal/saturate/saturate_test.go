@@ -0,0 +1,153 @@
+package saturate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/croessner/ldapbench/internal/config"
+	"github.com/croessner/ldapbench/internal/metrics"
+)
+
+// fakeLevels returns a LevelFunc whose p99 latency grows with the rate by
+// 1ms per 100/s and which records the tested rates.
+func fakeLevels(m *metrics.Metrics, tested *[]float64) LevelFunc {
+	return func(_ context.Context, name string, rate float64) (*metrics.StageMetrics, error) {
+		*tested = append(*tested, rate)
+
+		st := m.BeginStage(name)
+		for i := 0; i < 100; i++ {
+			st.Record(time.Duration(rate*float64(time.Millisecond)/100), nil)
+		}
+
+		m.EndStage()
+
+		return st, nil
+	}
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        config.Config
+		wantTested []float64
+		wantMax    float64
+	}{
+		{
+			name:       "linear",
+			cfg:        config.Config{FindMax: config.SearchLinear, FindFrom: 100, FindStep: 100},
+			wantTested: []float64{100, 200, 300, 400, 500, 600},
+			wantMax:    500,
+		},
+		{
+			name:       "linear bounded",
+			cfg:        config.Config{FindMax: config.SearchLinear, FindFrom: 100, FindTo: 300, FindStep: 100},
+			wantTested: []float64{100, 200, 300},
+			wantMax:    300,
+		},
+		{
+			name:       "binary",
+			cfg:        config.Config{FindMax: config.SearchBinary, FindFrom: 100, FindTo: 1000, FindStep: 50},
+			wantTested: []float64{100, 1000, 550, 350, 450, 500},
+			wantMax:    500,
+		},
+		{
+			name:       "binary nothing passes",
+			cfg:        config.Config{FindMax: config.SearchBinary, FindFrom: 600, FindTo: 1000, FindStep: 50},
+			wantTested: []float64{600},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// p99 <= 5.2ms passes rates up to 500/s
+			tt.cfg.SLO = config.SLO{P99: 5200 * time.Microsecond}
+
+			var tested []float64
+			res, err := Search(context.Background(), &tt.cfg, fakeLevels(metrics.New(), &tested))
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+
+			if !reflect.DeepEqual(tested, tt.wantTested) {
+				t.Fatalf("tested %v, want %v", tested, tt.wantTested)
+			}
+
+			if tt.wantMax == 0 {
+				if res.Max != nil {
+					t.Fatalf("expected no passing level, got %+v", res.Max)
+				}
+
+				return
+			}
+
+			if res.Max == nil || res.Max.Rate != tt.wantMax {
+				t.Fatalf("max = %+v, want %v", res.Max, tt.wantMax)
+			}
+
+			curve := res.Curve()
+			for i := 1; i < len(curve); i++ {
+				if curve[i].Rate < curve[i-1].Rate {
+					t.Fatalf("curve not ordered by rate: %+v", curve)
+				}
+			}
+		})
+	}
+}
+
+func TestSearch_Canceled(t *testing.T) {
+	cfg := &config.Config{FindMax: config.SearchLinear, FindFrom: 100, FindStep: 100, SLO: config.SLO{P99: time.Second}}
+	calls := 0
+	run := func(ctx context.Context, name string, rate float64) (*metrics.StageMetrics, error) {
+		if calls++; calls == 3 {
+			return nil, context.Canceled
+		}
+
+		st := metrics.New().BeginStage(name)
+		st.Record(time.Millisecond, nil)
+
+		return st, nil
+	}
+
+	res, err := Search(context.Background(), cfg, run)
+	if !errors.Is(err, context.Canceled) || len(res.Levels) != 2 || res.Max.Rate != 200 {
+		t.Fatalf("unexpected result after cancel: err=%v levels=%+v", err, res.Levels)
+	}
+}
+
+func TestJudge(t *testing.T) {
+	m := metrics.New()
+	st := m.BeginStage("rate100")
+	for i := 0; i < 98; i++ {
+		st.Record(time.Millisecond, nil)
+	}
+
+	st.Record(time.Millisecond, errors.New("busy"))
+	st.Record(time.Millisecond, errors.New("busy"))
+	m.EndStage()
+
+	tests := []struct {
+		slo      config.SLO
+		rate     float64
+		wantPass bool
+	}{
+		{slo: config.SLO{P99: 10 * time.Millisecond}, rate: 1, wantPass: true},
+		{slo: config.SLO{P99: 500 * time.Microsecond}, rate: 1},
+		{slo: config.SLO{ErrorRate: 1}, rate: 1},
+		{slo: config.SLO{ErrorRate: 5}, rate: 1, wantPass: true},
+		{slo: config.SLO{ErrorRate: 5, Throughput: 90}, rate: 1e9},
+	}
+
+	for _, tt := range tests {
+		l := Judge(st, tt.rate, tt.slo)
+		if l.Pass != tt.wantPass || (!l.Pass && l.Reason == "") {
+			t.Fatalf("Judge(%+v, %v) = %+v, want pass=%v", tt.slo, tt.rate, l, tt.wantPass)
+		}
+
+		if l.ErrorRate != 2 {
+			t.Fatalf("error rate = %v, want 2", l.ErrorRate)
+		}
+	}
+}